@@ -0,0 +1,28 @@
+package backup
+
+import (
+	"context"
+	"io"
+
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+)
+
+// Target is a remote location where etcd snapshots are stored
+type Target interface {
+	Upload(ctx context.Context, name string, content io.Reader, size int64) error
+	Download(ctx context.Context, name string) (io.ReadCloser, int64, error)
+}
+
+func NewTarget(targetConfig v3.BackupTarget) (Target, error) {
+	return newS3Target(targetConfig)
+}
+
+// notFoundError is returned when downloading an object that doesn't exist
+type notFoundError struct {
+	error
+}
+
+func IsNotFound(err error) bool {
+	_, ok := err.(*notFoundError)
+	return ok
+}
@@ -0,0 +1,221 @@
+package backup
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	S3DefaultEndpoint = "s3.amazonaws.com"
+	S3DefaultRegion   = "us-east-1"
+
+	s3SigningAlgorithm = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload  = "UNSIGNED-PAYLOAD"
+	s3EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3AmzDateFormat    = "20060102T150405Z"
+	s3ShortDateFormat  = "20060102"
+)
+
+type s3Target struct {
+	endpoint   *url.URL
+	region     string
+	bucket     string
+	accessKey  string
+	secretKey  string
+	httpClient *http.Client
+}
+
+func newS3Target(targetConfig v3.BackupTarget) (*s3Target, error) {
+	endpoint := targetConfig.Endpoint
+	if len(endpoint) == 0 {
+		endpoint = S3DefaultEndpoint
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse backup target endpoint [%s]: %v", targetConfig.Endpoint, err)
+	}
+	region := targetConfig.Region
+	if len(region) == 0 {
+		region = S3DefaultRegion
+	}
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+	}
+	if len(targetConfig.CustomCA) > 0 {
+		caPool := x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM([]byte(targetConfig.CustomCA)) {
+			return nil, fmt.Errorf("Failed to parse custom CA certificate of backup target [%s]", endpointURL.Host)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: caPool}
+	}
+	return &s3Target{
+		endpoint:   endpointURL,
+		region:     region,
+		bucket:     targetConfig.Bucket,
+		accessKey:  targetConfig.AccessKey,
+		secretKey:  targetConfig.SecretKey,
+		httpClient: &http.Client{Transport: transport},
+	}, nil
+}
+
+func (s *s3Target) Upload(ctx context.Context, name string, content io.Reader, size int64) error {
+	logrus.Debugf("[backup] Uploading [%s] to bucket [%s] on [%s]", name, s.bucket, s.endpoint.Host)
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(name), ioutil.NopCloser(content))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	s.signRequest(req, s3UnsignedPayload, time.Now().UTC())
+	resp, err := s.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("Failed to upload [%s] to bucket [%s]: %v", name, s.bucket, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Failed to upload [%s] to bucket [%s]: %s", name, s.bucket, readS3Error(resp))
+	}
+	return nil
+}
+
+func (s *s3Target) Download(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	logrus.Debugf("[backup] Downloading [%s] from bucket [%s] on [%s]", name, s.bucket, s.endpoint.Host)
+	req, err := http.NewRequest(http.MethodGet, s.objectURL(name), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	s.signRequest(req, s3EmptyPayloadHash, time.Now().UTC())
+	resp, err := s.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to download [%s] from bucket [%s]: %v", name, s.bucket, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		err := fmt.Errorf("Failed to download [%s] from bucket [%s]: %s", name, s.bucket, readS3Error(resp))
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, 0, &notFoundError{err}
+		}
+		return nil, 0, err
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// objectURL uses path style addressing, which is supported by S3 and most S3 compatible stores
+func (s *s3Target) objectURL(name string) string {
+	objectURL := *s.endpoint
+	objectURL.Path = "/" + s.bucket + "/" + name
+	return objectURL.String()
+}
+
+// signRequest adds AWS Signature Version 4 headers, signing the host header and all the headers set on the request
+func (s *s3Target) signRequest(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format(s3AmzDateFormat)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	headers := map[string]string{
+		"host": req.URL.Host,
+	}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	headerNames := []string{}
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	canonicalHeaders := ""
+	for _, name := range headerNames {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3URIEncode(req.URL.Path, false),
+		getS3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{now.Format(s3ShortDateFormat), s.region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		s3SigningAlgorithm,
+		amzDate,
+		scope,
+		hashSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format(s3ShortDateFormat))
+	signingKey = hmacSHA256(signingKey, s.region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SigningAlgorithm, s.accessKey, scope, signedHeaders, signature))
+}
+
+func getS3CanonicalQuery(query url.Values) string {
+	keys := []string{}
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, s3URIEncode(key, true)+"="+s3URIEncode(value, true))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func s3URIEncode(s string, encodeSlash bool) string {
+	encoded := ""
+	for _, b := range []byte(s) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' || (b == '/' && !encodeSlash) {
+			encoded += string(b)
+			continue
+		}
+		encoded += fmt.Sprintf("%%%02X", b)
+	}
+	return encoded
+}
+
+func hashSHA256(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func readS3Error(resp *http.Response) string {
+	body, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Sprintf("response code: [%d], response body: %s", resp.StatusCode, body)
+}
@@ -46,15 +46,7 @@ func (c *Cluster) DeployUserAddOns(ctx context.Context) error {
 
 func (c *Cluster) deployKubeDNS(ctx context.Context) error {
 	log.Infof(ctx, "[addons] Setting up KubeDNS")
-	kubeDNSConfig := map[string]string{
-		addons.KubeDNSServer:          c.ClusterDNSServer,
-		addons.KubeDNSClusterDomain:   c.ClusterDomain,
-		addons.KubeDNSImage:           c.SystemImages.KubeDNS,
-		addons.DNSMasqImage:           c.SystemImages.DNSmasq,
-		addons.KubeDNSSidecarImage:    c.SystemImages.KubeDNSSidecar,
-		addons.KubeDNSAutoScalerImage: c.SystemImages.KubeDNSAutoscaler,
-	}
-	kubeDNSYaml, err := addons.GetKubeDNSManifest(kubeDNSConfig)
+	kubeDNSYaml, err := c.getKubeDNSYaml()
 	if err != nil {
 		return err
 	}
@@ -66,6 +58,18 @@ func (c *Cluster) deployKubeDNS(ctx context.Context) error {
 
 }
 
+func (c *Cluster) getKubeDNSYaml() (string, error) {
+	kubeDNSConfig := map[string]string{
+		addons.KubeDNSServer:          c.ClusterDNSServer,
+		addons.KubeDNSClusterDomain:   c.ClusterDomain,
+		addons.KubeDNSImage:           c.SystemImages.KubeDNS,
+		addons.DNSMasqImage:           c.SystemImages.DNSmasq,
+		addons.KubeDNSSidecarImage:    c.SystemImages.KubeDNSSidecar,
+		addons.KubeDNSAutoScalerImage: c.SystemImages.KubeDNSAutoscaler,
+	}
+	return addons.GetKubeDNSManifest(kubeDNSConfig)
+}
+
 func (c *Cluster) doAddonDeploy(ctx context.Context, addonYaml, resourceName string) error {
 
 	err := c.StoreAddonConfigMap(ctx, addonYaml, resourceName)
@@ -88,7 +92,7 @@ func (c *Cluster) doAddonDeploy(ctx context.Context, addonYaml, resourceName str
 
 func (c *Cluster) StoreAddonConfigMap(ctx context.Context, addonYaml string, addonName string) error {
 	log.Infof(ctx, "[addons] Saving addon ConfigMap to Kubernetes")
-	kubeClient, err := k8s.NewClient(c.LocalKubeConfigPath)
+	kubeClient, err := k8s.NewClient(c.LocalKubeConfigPath, c.K8sDialer)
 	if err != nil {
 		return err
 	}
@@ -116,7 +120,7 @@ func (c *Cluster) StoreAddonConfigMap(ctx context.Context, addonYaml string, add
 
 func (c *Cluster) ApplySystemAddonExcuteJob(addonJob string) error {
 
-	if err := k8s.ApplyK8sSystemJob(addonJob, c.LocalKubeConfigPath); err != nil {
+	if err := k8s.ApplyK8sSystemJob(addonJob, c.LocalKubeConfigPath, c.K8sDialer); err != nil {
 		fmt.Println(err)
 		return err
 	}
@@ -129,13 +133,7 @@ func (c *Cluster) deployIngress(ctx context.Context) error {
 		log.Infof(ctx, "[ingress] ingress controller is not defined")
 		return nil
 	}
-	ingressConfig := ingressOptions{
-		RBACConfig:   c.Authorization.Mode,
-		Options:      c.Ingress.Options,
-		NodeSelector: c.Ingress.NodeSelector,
-	}
-	// Currently only deploying nginx ingress controller
-	ingressYaml, err := addons.GetNginxIngressManifest(ingressConfig)
+	ingressYaml, err := c.getIngressYaml()
 	if err != nil {
 		return err
 	}
@@ -145,3 +143,13 @@ func (c *Cluster) deployIngress(ctx context.Context) error {
 	log.Infof(ctx, "[ingress] ingress controller %s is successfully deployed", c.Ingress.Provider)
 	return nil
 }
+
+func (c *Cluster) getIngressYaml() (string, error) {
+	ingressConfig := ingressOptions{
+		RBACConfig:   c.Authorization.Mode,
+		Options:      c.Ingress.Options,
+		NodeSelector: c.Ingress.NodeSelector,
+	}
+	// Currently only deploying nginx ingress controller
+	return addons.GetNginxIngressManifest(ingressConfig)
+}
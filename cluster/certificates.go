@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/rancher/rke/docker"
 	"github.com/rancher/rke/hosts"
 	"github.com/rancher/rke/k8s"
 	"github.com/rancher/rke/log"
 	"github.com/rancher/rke/pki"
+	"github.com/rancher/rke/services"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 	"k8s.io/client-go/kubernetes"
@@ -33,14 +35,27 @@ func SetUpAuthentication(ctx context.Context, kubeCluster, currentCluster *Clust
 			}
 			log.Infof(ctx, "[certificates] No Certificate backup found on host [%s]", kubeCluster.EtcdHosts[0].Address)
 
-			kubeCluster.Certificates, err = pki.StartCertificatesGeneration(ctx,
-				kubeCluster.ControlPlaneHosts,
-				kubeCluster.EtcdHosts,
-				kubeCluster.ClusterDomain,
-				kubeCluster.LocalKubeConfigPath,
-				kubeCluster.KubernetesServiceIP)
-			if err != nil {
-				return fmt.Errorf("Failed to generate Kubernetes certificates: %v", err)
+			if len(kubeCluster.CustomCertsDir) > 0 {
+				kubeCluster.Certificates, err = pki.ReadCertificatesFromDir(ctx,
+					kubeCluster.CustomCertsDir,
+					kubeCluster.ControlPlaneHosts,
+					kubeCluster.EtcdHosts,
+					kubeCluster.ClusterDomain,
+					kubeCluster.LocalKubeConfigPath,
+					kubeCluster.KubernetesServiceIP)
+				if err != nil {
+					return fmt.Errorf("Failed to load custom Kubernetes certificates: %v", err)
+				}
+			} else {
+				kubeCluster.Certificates, err = pki.StartCertificatesGeneration(ctx,
+					kubeCluster.ControlPlaneHosts,
+					kubeCluster.EtcdHosts,
+					kubeCluster.ClusterDomain,
+					kubeCluster.LocalKubeConfigPath,
+					kubeCluster.KubernetesServiceIP)
+				if err != nil {
+					return fmt.Errorf("Failed to generate Kubernetes certificates: %v", err)
+				}
 			}
 			log.Infof(ctx, "[certificates] Temporarily saving certs to etcd host [%s]", kubeCluster.EtcdHosts[0].Address)
 			if err := pki.DeployCertificatesOnHost(ctx, kubeCluster.EtcdHosts, kubeCluster.EtcdHosts[0], kubeCluster.Certificates, kubeCluster.SystemImages.CertDownloader, pki.TempCertPath, kubeCluster.PrivateRegistriesMap); err != nil {
@@ -52,6 +67,179 @@ func SetUpAuthentication(ctx context.Context, kubeCluster, currentCluster *Clust
 	return nil
 }
 
+func RotateCertificates(ctx context.Context, kubeCluster, currentCluster *Cluster, components []string) error {
+	if err := checkCertificatesRotation(kubeCluster, currentCluster); err != nil {
+		return err
+	}
+	kubeCluster.Certificates = currentCluster.Certificates
+	log.Infof(ctx, "[certificates] Rotating certificates of components %v", components)
+	if err := kubeCluster.generateComponentCertificates(ctx, components); err != nil {
+		return err
+	}
+	if err := kubeCluster.deployRotatedCertificates(ctx, components); err != nil {
+		return err
+	}
+	return kubeCluster.saveRotatedCertificates(ctx)
+}
+
+func RotateCACertificates(ctx context.Context, kubeCluster, currentCluster *Cluster) error {
+	if err := checkCertificatesRotation(kubeCluster, currentCluster); err != nil {
+		return err
+	}
+	kubeCluster.Certificates = currentCluster.Certificates
+
+	// components trust both the old and the new CA while their certificates are reissued
+	log.Infof(ctx, "[certificates] Rotating CA certificate, deploying CA bundle with the old and new CA")
+	if err := pki.RotateCACertificate(ctx, kubeCluster.Certificates); err != nil {
+		return fmt.Errorf("Failed to rotate CA certificate: %v", err)
+	}
+	// the new CA key and the bundle are saved before anything signed by the new CA is deployed,
+	// so a rotation failing midway doesn't leave the cluster running on a CA that was never saved
+	if err := kubeCluster.saveRotatedCertificates(ctx); err != nil {
+		return err
+	}
+	if err := kubeCluster.deployRotatedCertificates(ctx, pki.ComponentCertificates); err != nil {
+		return err
+	}
+
+	// the kube-apiserver key is kept since it signs the service account tokens, so the existing tokens stay valid
+	log.Infof(ctx, "[certificates] Reissuing all certificates from the new CA")
+	if err := kubeCluster.generateComponentCertificates(ctx, pki.ComponentCertificates); err != nil {
+		return err
+	}
+	if err := kubeCluster.saveRotatedCertificates(ctx); err != nil {
+		return err
+	}
+	if err := kubeCluster.deployRotatedCertificates(ctx, pki.ComponentCertificates); err != nil {
+		return err
+	}
+
+	log.Infof(ctx, "[certificates] Removing the old CA from the CA bundle")
+	caCertificate := kubeCluster.Certificates[pki.CACertName]
+	caCertificate.BundledCert = nil
+	kubeCluster.Certificates[pki.CACertName] = caCertificate
+	if err := kubeCluster.saveRotatedCertificates(ctx); err != nil {
+		return err
+	}
+	if err := kubeCluster.deployRotatedCertificates(ctx, pki.ComponentCertificates); err != nil {
+		return err
+	}
+	// the Kubernetes client is re-initialized with the admin kubeconfig signed by the new CA
+	var err error
+	if kubeCluster.KubeClient, err = k8s.NewClient(kubeCluster.LocalKubeConfigPath, kubeCluster.K8sDialer); err != nil {
+		return fmt.Errorf("Failed to re-initialize Kubernetes Client: %v", err)
+	}
+	// the tokens are recreated so the CA certificate they carry is the new CA
+	log.Infof(ctx, "[certificates] Regenerating service account tokens")
+	if err := k8s.DeleteServiceAccountTokens(kubeCluster.KubeClient); err != nil {
+		return fmt.Errorf("Failed to regenerate service account tokens: %v", err)
+	}
+	return nil
+}
+
+// GetClusterCertificates loads the certificates from the state store, or the certificates backup on the first etcd host if the API is down
+func (c *Cluster) GetClusterCertificates(ctx context.Context) (map[string]pki.CertificatePKI, error) {
+	_, isKubernetesStore := c.stateStore.(*kubernetesStateStore)
+	if _, err := GetK8sVersion(c.LocalKubeConfigPath, c.K8sDialer); err == nil || !isKubernetesStore {
+		certificates, err := c.stateStore.GetCertificates(ctx, c.EtcdHosts)
+		if err != nil || certificates != nil {
+			return certificates, err
+		}
+	}
+	log.Infof(ctx, "[certificates] Kubernetes API is not reachable, fetching certificates backup from host [%s]", c.EtcdHosts[0].Address)
+	if err := c.TunnelHosts(ctx, false); err != nil {
+		return nil, err
+	}
+	certificates, err := pki.FetchCertificatesFromHost(ctx, c.EtcdHosts, c.EtcdHosts[0], c.SystemImages.Alpine, c.LocalKubeConfigPath, c.PrivateRegistriesMap)
+	if err != nil {
+		return nil, err
+	}
+	if certificates == nil {
+		return nil, fmt.Errorf("No certificates backup found on host [%s]", c.EtcdHosts[0].Address)
+	}
+	return certificates, nil
+}
+
+func checkCertificatesRotation(kubeCluster, currentCluster *Cluster) error {
+	if currentCluster == nil {
+		return fmt.Errorf("Failed to get the current cluster state, certificates can only be rotated on a running cluster")
+	}
+	if kubeCluster.Authentication.Strategy != X509AuthenticationProvider {
+		return fmt.Errorf("Certificates can only be rotated with [%s] authentication", X509AuthenticationProvider)
+	}
+	return nil
+}
+
+func (c *Cluster) generateComponentCertificates(ctx context.Context, components []string) error {
+	if err := pki.GenerateComponentCertificates(ctx,
+		c.Certificates,
+		components,
+		c.ControlPlaneHosts,
+		c.EtcdHosts,
+		c.ClusterDomain,
+		c.LocalKubeConfigPath,
+		c.KubernetesServiceIP); err != nil {
+		return fmt.Errorf("Failed to rotate certificates: %v", err)
+	}
+	return nil
+}
+
+func (c *Cluster) deployRotatedCertificates(ctx context.Context, components []string) error {
+	if err := c.SetUpHosts(ctx); err != nil {
+		return err
+	}
+	return c.restartCertificateComponents(ctx, components)
+}
+
+func (c *Cluster) saveRotatedCertificates(ctx context.Context) error {
+	if err := c.saveCurrentState(ctx, nil); err != nil {
+		return fmt.Errorf("[certificates] Failed to save certificates to local state file: %v", err)
+	}
+	log.Infof(ctx, "[certificates] Updating certificates backup on etcd host [%s]", c.EtcdHosts[0].Address)
+	if err := pki.DeployCertificatesOnHost(ctx, c.EtcdHosts, c.EtcdHosts[0], c.Certificates, c.SystemImages.CertDownloader, pki.TempCertPath, c.PrivateRegistriesMap); err != nil {
+		return err
+	}
+	var err error
+	c.KubeClient, err = k8s.NewClient(c.LocalKubeConfigPath, c.K8sDialer)
+	if err != nil {
+		return fmt.Errorf("Failed to re-initialize Kubernetes Client: %v", err)
+	}
+	if err := c.stateStore.SaveCertificates(ctx, c.Certificates); err != nil {
+		return fmt.Errorf("[certificates] Failed to Save Kubernetes certificates: %v", err)
+	}
+	return nil
+}
+
+// restartCertificateComponents restarts only the containers that use the rotated certificates,
+// plane by plane starting with etcd
+func (c *Cluster) restartCertificateComponents(ctx context.Context, components []string) error {
+	restartOrder := []struct {
+		component     string
+		containerName string
+		hosts         []*hosts.Host
+	}{
+		{pki.EtcdCertName, services.EtcdContainerName, c.EtcdHosts},
+		{pki.KubeAPICertName, services.KubeAPIContainerName, c.ControlPlaneHosts},
+		{pki.KubeControllerCertName, services.KubeControllerContainerName, c.ControlPlaneHosts},
+		{pki.KubeSchedulerCertName, services.SchedulerContainerName, c.ControlPlaneHosts},
+		{pki.KubeNodeCertName, services.KubeletContainerName, c.getUniqueHostList()},
+		{pki.KubeProxyCertName, services.KubeproxyContainerName, c.getUniqueHostList()},
+	}
+	for _, restart := range restartOrder {
+		if !isStringInSlice(restart.component, components) {
+			continue
+		}
+		// restart one host at a time to keep the component available
+		for _, host := range restart.hosts {
+			log.Infof(ctx, "[certificates] Restarting container [%s] on host [%s]", restart.containerName, host.Address)
+			if err := docker.RestartContainer(ctx, host.DClient, host.Address, restart.containerName); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func regenerateAPICertificate(c *Cluster, certificates map[string]pki.CertificatePKI) (map[string]pki.CertificatePKI, error) {
 	logrus.Debugf("[certificates] Regenerating kubeAPI certificate")
 	kubeAPIAltNames := pki.GetAltNames(c.ControlPlaneHosts, c.ClusterDomain, c.KubernetesServiceIP)
@@ -94,6 +282,7 @@ func getClusterCerts(ctx context.Context, kubeClient *kubernetes.Clientset, etcd
 		secretConfig := string(secret.Data["Config"])
 		certMap[certName] = pki.CertificatePKI{
 			Certificate:   secretCert[0],
+			BundledCert:   pki.GetBundledCert(secretCert),
 			Key:           secretKey.(*rsa.PrivateKey),
 			Config:        secretConfig,
 			EnvName:       string(secret.Data["EnvName"]),
@@ -129,7 +318,7 @@ func saveCertToKubernetes(kubeClient *kubernetes.Clientset, crtName string, crt
 
 	// build secret Data
 	secretData := map[string][]byte{
-		"Certificate": cert.EncodeCertPEM(crt.Certificate),
+		"Certificate": crt.CertPEM(),
 		"Key":         cert.EncodePrivateKeyPEM(crt.Key),
 		"EnvName":     []byte(crt.EnvName),
 		"KeyEnvName":  []byte(crt.KeyEnvName),
@@ -156,3 +345,12 @@ func saveCertToKubernetes(kubeClient *kubernetes.Clientset, crtName string, crt
 		return fmt.Errorf("[certificates] Timeout waiting for kubernetes to be ready")
 	}
 }
+
+func isStringInSlice(a string, list []string) bool {
+	for _, b := range list {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
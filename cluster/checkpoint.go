@@ -0,0 +1,197 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/rancher/rke/log"
+)
+
+const (
+	CheckpointFileExt = ".rkecheckpoint"
+
+	PhaseCheckPorts    = "check-ports"
+	PhaseReconcile     = "reconcile"
+	PhaseCertificates  = "certificates"
+	PhasePullImages    = "pull-images"
+	PhaseControlPlane  = "control-plane"
+	PhaseSaveState     = "save-state"
+	PhaseWorkerPlane   = "worker-plane"
+	PhaseNetworkPlugin = "network-plugin"
+	PhaseLabels        = "labels"
+	PhaseAddons        = "addons"
+)
+
+// Checkpoint records the phases of rke up, and the hosts of a phase, that were completed for a cluster configuration
+type Checkpoint struct {
+	ConfigHash      string              `json:"configHash"`
+	CompletedPhases []string            `json:"completedPhases"`
+	CompletedHosts  map[string][]string `json:"completedHosts"`
+
+	path string
+	lock sync.Mutex
+}
+
+func GetCheckpointFile(configPath, configDir string) string {
+	return getClusterFileWithExt(configPath, configDir, CheckpointFileExt)
+}
+
+// getClusterFileWithExt returns the path of a file next to the cluster file, named after it with another extension
+func getClusterFileWithExt(configPath, configDir, ext string) string {
+	baseDir := filepath.Dir(configPath)
+	if len(configDir) > 0 {
+		baseDir = filepath.Dir(configDir)
+	}
+	fileName := filepath.Base(configPath)
+	return filepath.Join(baseDir, strings.TrimSuffix(fileName, filepath.Ext(fileName))+ext)
+}
+
+// SetUpCheckpoint starts recording the progress of rke up. When resuming, the checkpoint of a previous run is used
+// if it was recorded for the same configuration, otherwise all the phases run again
+func (c *Cluster) SetUpCheckpoint(ctx context.Context, currentCluster *Cluster, resume bool) error {
+	configHash, err := getConfigHash(c)
+	if err != nil {
+		return err
+	}
+	checkpoint := &Checkpoint{
+		ConfigHash:     configHash,
+		CompletedHosts: map[string][]string{},
+		path:           c.CheckpointPath,
+	}
+	if resume {
+		previousCheckpoint, err := readCheckpoint(c.CheckpointPath)
+		if err != nil {
+			return err
+		}
+		switch {
+		case previousCheckpoint == nil:
+			log.Infof(ctx, "[checkpoint] No checkpoint found at [%s], running all the phases", c.CheckpointPath)
+		case previousCheckpoint.ConfigHash != configHash:
+			log.Infof(ctx, "[checkpoint] Cluster configuration changed since the checkpoint was recorded, running all the phases")
+		case currentCluster == nil:
+			// certificates are generated again without a cluster state, so the hosts need them deployed again
+			log.Infof(ctx, "[checkpoint] Cluster state wasn't found, running all the phases")
+		case !isStringInSlice(PhaseSaveState, previousCheckpoint.CompletedPhases):
+			// certificates changed by the previous run weren't saved, only the phases that don't depend on them are skipped
+			for _, phase := range []string{PhaseCheckPorts, PhasePullImages} {
+				if isStringInSlice(phase, previousCheckpoint.CompletedPhases) {
+					checkpoint.CompletedPhases = append(checkpoint.CompletedPhases, phase)
+				}
+			}
+			log.Infof(ctx, "[checkpoint] Cluster state wasn't saved by the previous run, resuming from checkpoint [%s], completed phases: %v", c.CheckpointPath, checkpoint.CompletedPhases)
+		default:
+			log.Infof(ctx, "[checkpoint] Resuming from checkpoint [%s], completed phases: %v", c.CheckpointPath, previousCheckpoint.CompletedPhases)
+			checkpoint.CompletedPhases = previousCheckpoint.CompletedPhases
+			if previousCheckpoint.CompletedHosts != nil {
+				checkpoint.CompletedHosts = previousCheckpoint.CompletedHosts
+			}
+		}
+	}
+	c.checkpoint = checkpoint
+	return checkpoint.save()
+}
+
+// RunPhase runs a phase of rke up and records it in the checkpoint, a phase that is already completed is skipped
+func (c *Cluster) RunPhase(ctx context.Context, phase string, run func() error) error {
+	if c.checkpoint.isPhaseCompleted(phase) {
+		log.Infof(ctx, "[checkpoint] Skipping completed phase [%s]", phase)
+		return nil
+	}
+	if err := run(); err != nil {
+		return err
+	}
+	return c.checkpoint.completePhase(phase)
+}
+
+// RemoveCheckpoint deletes the checkpoint once rke up succeeded
+func (c *Cluster) RemoveCheckpoint() error {
+	if c.checkpoint == nil {
+		return nil
+	}
+	if err := os.Remove(c.checkpoint.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to remove checkpoint [%s]: %v", c.checkpoint.path, err)
+	}
+	c.checkpoint = nil
+	return nil
+}
+
+// The checkpoint methods are safe to call on a nil checkpoint, which records nothing
+
+func (cp *Checkpoint) isPhaseCompleted(phase string) bool {
+	if cp == nil {
+		return false
+	}
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+	return isStringInSlice(phase, cp.CompletedPhases)
+}
+
+func (cp *Checkpoint) isHostCompleted(phase, address string) bool {
+	if cp == nil {
+		return false
+	}
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+	return isStringInSlice(address, cp.CompletedHosts[phase])
+}
+
+func (cp *Checkpoint) completePhase(phase string) error {
+	if cp == nil {
+		return nil
+	}
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+	cp.CompletedPhases = append(cp.CompletedPhases, phase)
+	delete(cp.CompletedHosts, phase)
+	return cp.saveLocked()
+}
+
+func (cp *Checkpoint) completeHost(phase, address string) error {
+	if cp == nil {
+		return nil
+	}
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+	if !isStringInSlice(address, cp.CompletedHosts[phase]) {
+		cp.CompletedHosts[phase] = append(cp.CompletedHosts[phase], address)
+	}
+	return cp.saveLocked()
+}
+
+func (cp *Checkpoint) save() error {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+	return cp.saveLocked()
+}
+
+func (cp *Checkpoint) saveLocked() error {
+	checkpoint, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to encode checkpoint: %v", err)
+	}
+	if err := ioutil.WriteFile(cp.path, checkpoint, 0640); err != nil {
+		return fmt.Errorf("Failed to write checkpoint [%s]: %v", cp.path, err)
+	}
+	return nil
+}
+
+func readCheckpoint(path string) (*Checkpoint, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Failed to read checkpoint [%s]: %v", path, err)
+	}
+	checkpoint := &Checkpoint{}
+	if err := json.Unmarshal(content, checkpoint); err != nil {
+		return nil, fmt.Errorf("Failed to decode checkpoint [%s]: %v", path, err)
+	}
+	return checkpoint, nil
+}
@@ -0,0 +1,135 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+)
+
+const (
+	TestCheckpointHost = "1.1.1.1"
+)
+
+func TestRunPhase(t *testing.T) {
+	kubeCluster, cleanup := newTestCheckpointCluster(t, "v1.8.10")
+	defer cleanup()
+	if err := kubeCluster.SetUpCheckpoint(context.Background(), nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := 0
+	run := func() error {
+		runs++
+		return nil
+	}
+	if err := kubeCluster.RunPhase(context.Background(), PhaseCheckPorts, run); err != nil {
+		t.Fatal(err)
+	}
+	if err := kubeCluster.RunPhase(context.Background(), PhaseCheckPorts, run); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, runs, 1, "Failed to skip completed phase")
+
+	if err := kubeCluster.RunPhase(context.Background(), PhasePullImages, func() error {
+		return fmt.Errorf("pull failed")
+	}); err == nil {
+		t.Fatal("Failed to return the error of a phase")
+	}
+	assertEqual(t, kubeCluster.checkpoint.isPhaseCompleted(PhasePullImages), false, "Failed phase must not be recorded as completed")
+
+	checkpoint, err := readCheckpoint(kubeCluster.CheckpointPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, strings.Join(checkpoint.CompletedPhases, ","), PhaseCheckPorts, "Failed to save completed phases")
+
+	if err := kubeCluster.RemoveCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(kubeCluster.CheckpointPath); !os.IsNotExist(err) {
+		t.Fatalf("Failed to remove checkpoint [%s]", kubeCluster.CheckpointPath)
+	}
+	// phases run without a checkpoint aren't recorded
+	if err := kubeCluster.RunPhase(context.Background(), PhaseCheckPorts, run); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, runs, 2, "Failed to run phase without a checkpoint")
+}
+
+func TestSetUpCheckpoint(t *testing.T) {
+	savedPhases := []string{PhaseCheckPorts, PhaseReconcile, PhaseCertificates, PhasePullImages, PhaseControlPlane, PhaseSaveState}
+	unsavedPhases := []string{PhaseCheckPorts, PhaseReconcile, PhasePullImages}
+	tests := []struct {
+		name            string
+		previousPhases  []string
+		version         string
+		currentCluster  *Cluster
+		resume          bool
+		completedPhases []string
+		completedHost   bool
+	}{
+		{"without resume", savedPhases, "v1.8.10", &Cluster{}, false, nil, false},
+		{"resume", savedPhases, "v1.8.10", &Cluster{}, true, savedPhases, true},
+		{"changed configuration", savedPhases, "v1.9.5", &Cluster{}, true, nil, false},
+		{"missing cluster state", savedPhases, "v1.8.10", nil, true, nil, false},
+		{"unsaved cluster state", unsavedPhases, "v1.8.10", &Cluster{}, true, []string{PhaseCheckPorts, PhasePullImages}, false},
+	}
+	for _, test := range tests {
+		previousCluster, cleanup := newTestCheckpointCluster(t, "v1.8.10")
+		if err := previousCluster.SetUpCheckpoint(context.Background(), nil, false); err != nil {
+			t.Fatal(err)
+		}
+		for _, phase := range test.previousPhases {
+			if err := previousCluster.RunPhase(context.Background(), phase, func() error { return nil }); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := previousCluster.checkpoint.completeHost(PhaseWorkerPlane, TestCheckpointHost); err != nil {
+			t.Fatal(err)
+		}
+
+		kubeCluster := &Cluster{
+			RancherKubernetesEngineConfig: getTestCheckpointConfig(test.version),
+			CheckpointPath:                previousCluster.CheckpointPath,
+		}
+		if err := kubeCluster.SetUpCheckpoint(context.Background(), test.currentCluster, test.resume); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, strings.Join(kubeCluster.checkpoint.CompletedPhases, ","), strings.Join(test.completedPhases, ","),
+			fmt.Sprintf("Failed to verify completed phases of [%s]", test.name))
+		assertEqual(t, kubeCluster.checkpoint.isHostCompleted(PhaseWorkerPlane, TestCheckpointHost), test.completedHost,
+			fmt.Sprintf("Failed to verify completed worker plane host of [%s]", test.name))
+		cleanup()
+	}
+}
+
+func newTestCheckpointCluster(t *testing.T, version string) (*Cluster, func()) {
+	dir, err := ioutil.TempDir("", "rke-checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeCluster := &Cluster{
+		RancherKubernetesEngineConfig: getTestCheckpointConfig(version),
+		CheckpointPath:                GetCheckpointFile(filepath.Join(dir, DefaultClusterConfig), ""),
+	}
+	return kubeCluster, func() { os.RemoveAll(dir) }
+}
+
+func getTestCheckpointConfig(version string) v3.RancherKubernetesEngineConfig {
+	rkeConfig := v3.RancherKubernetesEngineConfig{
+		Nodes: []v3.RKEConfigNode{
+			{
+				Address: TestCheckpointHost,
+				Role:    []string{"etcd", "controlplane", "worker"},
+			},
+		},
+	}
+	rkeConfig.SystemImages.Kubernetes = "rancher/k8s:" + version
+	return rkeConfig
+}
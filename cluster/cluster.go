@@ -27,6 +27,8 @@ type Cluster struct {
 	v3.RancherKubernetesEngineConfig `yaml:",inline"`
 	ConfigPath                       string
 	LocalKubeConfigPath              string
+	CheckpointPath                   string
+	StateFilePath                    string
 	EtcdHosts                        []*hosts.Host
 	WorkerHosts                      []*hosts.Host
 	ControlPlaneHosts                []*hosts.Host
@@ -38,7 +40,16 @@ type Cluster struct {
 	ClusterDNSServer                 string
 	DockerDialerFactory              hosts.DialerFactory
 	LocalConnDialerFactory           hosts.DialerFactory
+	K8sDialer                        k8s.DialFunc
 	PrivateRegistriesMap             map[string]v3.PrivateRegistry
+	SkipDrain                        bool
+	ForceMembershipChange            bool
+	SkipVersionCheck                 bool
+	knownHosts                       *hosts.KnownHosts
+	sshPool                          *hosts.SSHPool
+	upgrade                          *kubernetesUpgrade
+	checkpoint                       *Checkpoint
+	stateStore                       StateStore
 }
 
 const (
@@ -55,38 +66,105 @@ const (
 
 func (c *Cluster) DeployControlPlane(ctx context.Context) error {
 	// Deploy Etcd Plane
-	if err := services.RunEtcdPlane(ctx, c.EtcdHosts, c.Services.Etcd, c.LocalConnDialerFactory, c.PrivateRegistriesMap); err != nil {
+	clientCert := cert.EncodeCertPEM(c.Certificates[pki.KubeNodeCertName].Certificate)
+	clientKey := cert.EncodePrivateKeyPEM(c.Certificates[pki.KubeNodeCertName].Key)
+	if err := c.runUpgradeStep(ctx, upgradeStepEtcd, func() error {
+		return services.RunEtcdPlane(ctx, c.EtcdHosts, c.Services.Etcd, c.LocalConnDialerFactory, c.PrivateRegistriesMap, clientCert, clientKey)
+	}); err != nil {
 		return fmt.Errorf("[etcd] Failed to bring up Etcd Plane: %v", err)
 	}
-	// Deploy Control plane
-	if err := services.RunControlPlane(ctx, c.ControlPlaneHosts,
-		c.EtcdHosts,
-		c.Services,
-		c.SystemImages.KubernetesServicesSidecar,
-		c.Authorization.Mode,
-		c.LocalConnDialerFactory,
-		c.PrivateRegistriesMap); err != nil {
-		return fmt.Errorf("[controlPlane] Failed to bring up Control Plane: %v", err)
+	// Deploy Control plane, Kubernetes upgrades record the progress of each host
+	if c.upgrade == nil {
+		if err := c.runControlPlane(ctx, c.ControlPlaneHosts); err != nil {
+			return fmt.Errorf("[controlPlane] Failed to bring up Control Plane: %v", err)
+		}
+		return c.applyAuthzResources(ctx)
+	}
+	for _, host := range c.ControlPlaneHosts {
+		controlHosts := []*hosts.Host{host}
+		if err := c.runUpgradeStep(ctx, upgradeStepControlHostPrefix+host.Address, func() error {
+			return c.runControlPlane(ctx, controlHosts)
+		}); err != nil {
+			return fmt.Errorf("[controlPlane] Failed to upgrade Control Plane: %v", err)
+		}
 	}
-	// Apply Authz configuration after deploying controlplane
+	return c.applyAuthzResources(ctx)
+}
+
+// applyAuthzResources applies the Authz configuration after deploying controlplane
+func (c *Cluster) applyAuthzResources(ctx context.Context) error {
 	if err := c.ApplyAuthzResources(ctx); err != nil {
 		return fmt.Errorf("[auths] Failed to apply RBAC resources: %v", err)
 	}
 	return nil
 }
 
-func (c *Cluster) DeployWorkerPlane(ctx context.Context) error {
-	// Deploy Worker Plane
-	if err := services.RunWorkerPlane(ctx, c.ControlPlaneHosts,
-		c.WorkerHosts,
+func (c *Cluster) runControlPlane(ctx context.Context, controlHosts []*hosts.Host) error {
+	return services.RunControlPlane(ctx, controlHosts,
 		c.EtcdHosts,
 		c.Services,
-		c.SystemImages.NginxProxy,
 		c.SystemImages.KubernetesServicesSidecar,
+		c.Authorization.Mode,
 		c.LocalConnDialerFactory,
-		c.PrivateRegistriesMap); err != nil {
-		return fmt.Errorf("[workerPlane] Failed to bring up Worker Plane: %v", err)
+		c.PrivateRegistriesMap)
+}
+
+func (c *Cluster) DeployWorkerPlane(ctx context.Context) error {
+	if c.upgrade == nil {
+		return c.deployWorkerPlane(ctx, c.UpgradeStrategy)
+	}
+	// Kubernetes upgrades roll the worker hosts one at a time, unless an upgrade strategy is configured
+	upgradeStrategy := c.UpgradeStrategy
+	if upgradeStrategy == nil {
+		upgradeStrategy = &v3.UpgradeStrategy{}
 	}
+	return c.runUpgradeStep(ctx, upgradeStepWorkerPlane, func() error {
+		return c.deployWorkerPlane(ctx, upgradeStrategy)
+	})
+}
+
+func (c *Cluster) deployWorkerPlane(ctx context.Context, upgradeStrategy *v3.UpgradeStrategy) error {
+	if upgradeStrategy != nil {
+		kubeClient, err := k8s.NewClient(c.LocalKubeConfigPath, c.K8sDialer)
+		if err != nil {
+			return fmt.Errorf("Failed to initialize new kubernetes client: %v", err)
+		}
+		if err := services.UpgradeWorkerPlane(ctx, kubeClient,
+			c.ControlPlaneHosts,
+			c.WorkerHosts,
+			c.EtcdHosts,
+			c.Services,
+			c.SystemImages.NginxProxy,
+			c.SystemImages.KubernetesServicesSidecar,
+			c.LocalConnDialerFactory,
+			c.PrivateRegistriesMap,
+			*upgradeStrategy,
+			c.NodeDrain); err != nil {
+			return fmt.Errorf("[workerPlane] Failed to upgrade Worker Plane: %v", err)
+		}
+		return nil
+	}
+	// Deploy Worker Plane, recording each host in the checkpoint
+	log.Infof(ctx, "[%s] Building up Worker Plane..", services.WorkerRole)
+	for _, planeHosts := range [][]*hosts.Host{c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts} {
+		var errgrp errgroup.Group
+		for _, host := range planeHosts {
+			if c.checkpoint.isHostCompleted(PhaseWorkerPlane, host.Address) {
+				continue
+			}
+			runHost := host
+			errgrp.Go(func() error {
+				if err := services.DeployWorkerPlaneHost(ctx, runHost, c.ControlPlaneHosts, c.Services, c.SystemImages.NginxProxy, c.SystemImages.KubernetesServicesSidecar, c.LocalConnDialerFactory, c.PrivateRegistriesMap); err != nil {
+					return err
+				}
+				return c.checkpoint.completeHost(PhaseWorkerPlane, runHost.Address)
+			})
+		}
+		if err := errgrp.Wait(); err != nil {
+			return fmt.Errorf("[workerPlane] Failed to bring up Worker Plane: %v", err)
+		}
+	}
+	log.Infof(ctx, "[%s] Successfully started Worker Plane..", services.WorkerRole)
 	return nil
 }
 
@@ -104,7 +182,8 @@ func ParseCluster(
 	rkeConfig *v3.RancherKubernetesEngineConfig,
 	clusterFilePath, configDir string,
 	dockerDialerFactory,
-	localConnDialerFactory hosts.DialerFactory) (*Cluster, error) {
+	localConnDialerFactory hosts.DialerFactory,
+	stateStore StateStore) (*Cluster, error) {
 	var err error
 	c := &Cluster{
 		RancherKubernetesEngineConfig: *rkeConfig,
@@ -135,6 +214,20 @@ func ParseCluster(
 		c.ConfigPath = DefaultClusterConfig
 	}
 	c.LocalKubeConfigPath = GetLocalKubeConfig(c.ConfigPath, configDir)
+	c.CheckpointPath = GetCheckpointFile(c.ConfigPath, configDir)
+	c.StateFilePath = GetStateFile(c.ConfigPath, configDir)
+	if err := c.setUpKnownHosts(nil); err != nil {
+		return nil, err
+	}
+	// the state store given by the caller takes precedence over the state_store configuration
+	if c.stateStore = stateStore; c.stateStore == nil {
+		if c.stateStore, err = c.newStateStore(); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.loadStoredHostKeys(ctx); err != nil {
+		return nil, err
+	}
 
 	for _, pr := range c.PrivateRegistries {
 		if pr.URL == "" {
@@ -176,7 +269,7 @@ func rebuildLocalAdminConfig(ctx context.Context, kubeCluster *Cluster) error {
 			return fmt.Errorf("Failed to redeploy local admin config with new host")
 		}
 		workingConfig = newConfig
-		if _, err := GetK8sVersion(kubeCluster.LocalKubeConfigPath); err == nil {
+		if _, err := GetK8sVersion(kubeCluster.LocalKubeConfigPath, kubeCluster.K8sDialer); err == nil {
 			log.Infof(ctx, "[reconcile] host [%s] is active master on the cluster", cpHost.Address)
 			break
 		}
@@ -186,8 +279,8 @@ func rebuildLocalAdminConfig(ctx context.Context, kubeCluster *Cluster) error {
 	return nil
 }
 
-func isLocalConfigWorking(ctx context.Context, localKubeConfigPath string) bool {
-	if _, err := GetK8sVersion(localKubeConfigPath); err != nil {
+func isLocalConfigWorking(ctx context.Context, localKubeConfigPath string, k8sDialer k8s.DialFunc) bool {
+	if _, err := GetK8sVersion(localKubeConfigPath, k8sDialer); err != nil {
 		log.Infof(ctx, "[reconcile] Local config is not vaild, rebuilding admin config")
 		return false
 	}
@@ -216,22 +309,22 @@ func getLocalAdminConfigWithNewAddress(localConfigPath, cpAddress string) string
 }
 
 func (c *Cluster) ApplyAuthzResources(ctx context.Context) error {
-	if err := authz.ApplyJobDeployerServiceAccount(ctx, c.LocalKubeConfigPath); err != nil {
+	if err := authz.ApplyJobDeployerServiceAccount(ctx, c.LocalKubeConfigPath, c.K8sDialer); err != nil {
 		return fmt.Errorf("Failed to apply the ServiceAccount needed for job execution: %v", err)
 	}
 	if c.Authorization.Mode == NoneAuthorizationMode {
 		return nil
 	}
 	if c.Authorization.Mode == services.RBACAuthorizationMode {
-		if err := authz.ApplySystemNodeClusterRoleBinding(ctx, c.LocalKubeConfigPath); err != nil {
+		if err := authz.ApplySystemNodeClusterRoleBinding(ctx, c.LocalKubeConfigPath, c.K8sDialer); err != nil {
 			return fmt.Errorf("Failed to apply the ClusterRoleBinding needed for node authorization: %v", err)
 		}
 	}
 	if c.Authorization.Mode == services.RBACAuthorizationMode && c.Services.KubeAPI.PodSecurityPolicy {
-		if err := authz.ApplyDefaultPodSecurityPolicy(ctx, c.LocalKubeConfigPath); err != nil {
+		if err := authz.ApplyDefaultPodSecurityPolicy(ctx, c.LocalKubeConfigPath, c.K8sDialer); err != nil {
 			return fmt.Errorf("Failed to apply default PodSecurityPolicy: %v", err)
 		}
-		if err := authz.ApplyDefaultPodSecurityPolicyRole(ctx, c.LocalKubeConfigPath); err != nil {
+		if err := authz.ApplyDefaultPodSecurityPolicyRole(ctx, c.LocalKubeConfigPath, c.K8sDialer); err != nil {
 			return fmt.Errorf("Failed to apply default PodSecurityPolicy ClusterRole and ClusterRoleBinding: %v", err)
 		}
 	}
@@ -264,7 +357,7 @@ func (c *Cluster) DeployAddons(ctx context.Context) error {
 
 func (c *Cluster) SyncLabelsAndTaints(ctx context.Context) error {
 	log.Infof(ctx, "[sync] Syncing nodes Labels and Taints")
-	k8sClient, err := k8s.NewClient(c.LocalKubeConfigPath)
+	k8sClient, err := k8s.NewClient(c.LocalKubeConfigPath, c.K8sDialer)
 	if err != nil {
 		return fmt.Errorf("Failed to initialize new kubernetes client: %v", err)
 	}
@@ -0,0 +1,43 @@
+package cluster
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+)
+
+func TestInvertIndexHostsTaints(t *testing.T) {
+	kubeCluster := &Cluster{
+		RancherKubernetesEngineConfig: v3.RancherKubernetesEngineConfig{
+			Nodes: []v3.RKEConfigNode{
+				{Address: "1.1.1.1", Role: []string{"etcd"}},
+				{Address: "2.2.2.2", Role: []string{"etcd", "controlplane"}},
+				{Address: "3.3.3.3", Role: []string{"worker"}},
+			},
+		},
+	}
+	if err := kubeCluster.InvertIndexHosts(); err != nil {
+		t.Fatal(err)
+	}
+	expectedTaints := map[string]string{
+		"1.1.1.1": unschedulableEtcdTaint,
+		"2.2.2.2": "",
+		"3.3.3.3": "",
+	}
+	for _, host := range kubeCluster.getUniqueHostList() {
+		assertEqual(t, strings.Join(host.ToAddTaints, ","), expectedTaints[host.Address],
+			fmt.Sprintf("Failed to verify taints of host [%s]", host.Address))
+	}
+}
+
+func assertEqual(t *testing.T, a interface{}, b interface{}, message string) {
+	if a == b {
+		return
+	}
+	if len(message) == 0 {
+		message = fmt.Sprintf("%v != %v", a, b)
+	}
+	t.Fatal(message)
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 
 	ref "github.com/docker/distribution/reference"
+	"github.com/rancher/rke/hosts"
 	"github.com/rancher/rke/log"
 	"github.com/rancher/rke/services"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
 )
 
 const (
@@ -16,6 +18,12 @@ const (
 	DefaultClusterDNSService     = "10.233.0.3"
 	DefaultClusterDomain         = "cluster.local"
 	DefaultClusterSSHKeyPath     = "~/.ssh/id_rsa"
+	DefaultSSHKnownHostsPath     = "~/.ssh/known_hosts"
+	DefaultSSHHostKeyChecking    = hosts.TrustOnFirstUseHostKeyChecking
+	DefaultSSHTimeout            = 30
+	DefaultSSHRetries            = 3
+	DefaultSSHRetryBackoff       = 2
+	DefaultSSHMaxRetryBackoff    = 30
 
 	DefaultDockerSockPath = "/var/run/docker.sock"
 
@@ -35,6 +43,11 @@ const (
 	DefaultEtcdImage = "rancher/etcd:v3.0.17"
 	DefaultK8sImage  = "rancher/k8s:v1.8.7-rancher1-1"
 
+	DefaultEtcdSnapshotInterval  = "6h"
+	DefaultEtcdSnapshotRetention = "24h"
+
+	DefaultNodeDrainTimeout = 120
+
 	DefaultFlannelImage    = "rancher/coreos-flannel:v0.9.1"
 	DefaultFlannelCNIImage = "rancher/coreos-flannel-cni:v0.2.0"
 
@@ -68,11 +81,41 @@ func setDefaultIfEmpty(varName *string, defaultValue string) {
 	}
 }
 
+func setDefaultIfNil(varName **int, defaultValue int) {
+	if *varName == nil {
+		*varName = &defaultValue
+	}
+}
+
+// setBastionHostDefaults uses the cluster SSH credentials for the bastion hosts without credentials
+func (c *Cluster) setBastionHostDefaults(bastionHost *v3.BastionHost) {
+	if bastionHost == nil {
+		return
+	}
+	setDefaultIfEmpty(&bastionHost.Port, hosts.DefaultSSHPort)
+	if len(bastionHost.SSHKey) == 0 {
+		setDefaultIfEmpty(&bastionHost.SSHKeyPath, c.SSHKeyPath)
+	}
+	if bastionHost.SSHAgentAuth == nil {
+		sshAgentAuth := c.SSHAgentAuth
+		bastionHost.SSHAgentAuth = &sshAgentAuth
+	}
+}
+
 func (c *Cluster) setClusterDefaults(ctx context.Context) {
 	if len(c.SSHKeyPath) == 0 {
 		c.SSHKeyPath = DefaultClusterSSHKeyPath
 	}
+	setDefaultIfEmpty(&c.SSHKnownHostsPath, DefaultSSHKnownHostsPath)
+	setDefaultIfEmpty(&c.SSHHostKeyChecking, DefaultSSHHostKeyChecking)
+	// 0 is a valid value of the SSH options, only the unset options use the defaults
+	setDefaultIfNil(&c.SSHTimeout, DefaultSSHTimeout)
+	setDefaultIfNil(&c.SSHRetries, DefaultSSHRetries)
+	setDefaultIfNil(&c.SSHRetryBackoff, DefaultSSHRetryBackoff)
+	setDefaultIfNil(&c.SSHMaxRetryBackoff, DefaultSSHMaxRetryBackoff)
+	c.setBastionHostDefaults(c.BastionHost)
 	for i, host := range c.Nodes {
+		setDefaultIfEmpty(&c.Nodes[i].Port, hosts.DefaultSSHPort)
 		if len(host.InternalAddress) == 0 {
 			c.Nodes[i].InternalAddress = c.Nodes[i].Address
 		}
@@ -83,6 +126,15 @@ func (c *Cluster) setClusterDefaults(ctx context.Context) {
 		if len(host.SSHKeyPath) == 0 {
 			c.Nodes[i].SSHKeyPath = c.SSHKeyPath
 		}
+		if len(host.SSHCert) == 0 && len(host.SSHCertPath) == 0 {
+			c.Nodes[i].SSHCertPath = c.SSHCertPath
+		}
+		// a node that sets ssh_agent_auth keeps it, the others use ssh_agent_auth of the cluster
+		if host.SSHAgentAuth == nil {
+			sshAgentAuth := c.SSHAgentAuth
+			c.Nodes[i].SSHAgentAuth = &sshAgentAuth
+		}
+		c.setBastionHostDefaults(host.BastionHost)
 	}
 	if len(c.Authorization.Mode) == 0 {
 		c.Authorization.Mode = DefaultAuthorizationMode
@@ -94,6 +146,9 @@ func (c *Cluster) setClusterDefaults(ctx context.Context) {
 	if len(c.Ingress.Provider) == 0 {
 		c.Ingress.Provider = DefaultIngressController
 	}
+	if c.NodeDrain.Timeout == 0 {
+		c.NodeDrain.Timeout = DefaultNodeDrainTimeout
+	}
 
 	c.setClusterImageDefaults()
 	c.setClusterKubernetesImageVersion(ctx)
@@ -135,6 +190,10 @@ func (c *Cluster) setClusterServicesDefaults() {
 	for k, v := range serviceConfigDefaultsMap {
 		setDefaultIfEmpty(k, v)
 	}
+	if c.Services.Etcd.Snapshot != nil {
+		setDefaultIfEmpty(&c.Services.Etcd.Snapshot.Interval, DefaultEtcdSnapshotInterval)
+		setDefaultIfEmpty(&c.Services.Etcd.Snapshot.Retention, DefaultEtcdSnapshotRetention)
+	}
 }
 
 func (c *Cluster) setClusterImageDefaults() {
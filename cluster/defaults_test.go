@@ -0,0 +1,68 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+)
+
+func TestSSHAgentAuthDefaults(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		name         string
+		clusterAuth  bool
+		nodeAuth     *bool
+		expectedAuth bool
+	}{
+		{"cluster enabled, node unset", true, nil, true},
+		{"cluster enabled, node disabled", true, &disabled, false},
+		{"cluster disabled, node unset", false, nil, false},
+		{"cluster disabled, node enabled", false, &enabled, true},
+	}
+	for _, test := range tests {
+		kubeCluster := &Cluster{
+			RancherKubernetesEngineConfig: v3.RancherKubernetesEngineConfig{
+				SSHAgentAuth: test.clusterAuth,
+				BastionHost:  &v3.BastionHost{Address: "10.0.0.10", SSHAgentAuth: test.nodeAuth},
+				Nodes: []v3.RKEConfigNode{
+					{Address: "1.1.1.1", Role: []string{"etcd", "controlplane", "worker"}, SSHAgentAuth: test.nodeAuth},
+				},
+			},
+		}
+		kubeCluster.setClusterDefaults(context.Background())
+		nodeAuth := kubeCluster.Nodes[0].SSHAgentAuth
+		assertEqual(t, nodeAuth != nil && *nodeAuth == test.expectedAuth, true, fmt.Sprintf("Failed to verify ssh_agent_auth of node for [%s]", test.name))
+		bastionAuth := kubeCluster.BastionHost.SSHAgentAuth
+		assertEqual(t, bastionAuth != nil && *bastionAuth == test.expectedAuth, true, fmt.Sprintf("Failed to verify ssh_agent_auth of bastion host for [%s]", test.name))
+	}
+}
+
+func TestSSHOptionsDefaults(t *testing.T) {
+	zero := 0
+	tests := []struct {
+		name            string
+		timeout         *int
+		retries         *int
+		expectedTimeout int
+		expectedRetries int
+	}{
+		{"unset", nil, nil, DefaultSSHTimeout, DefaultSSHRetries},
+		{"disabled", &zero, &zero, 0, 0},
+	}
+	for _, test := range tests {
+		kubeCluster := &Cluster{
+			RancherKubernetesEngineConfig: v3.RancherKubernetesEngineConfig{
+				SSHTimeout: test.timeout,
+				SSHRetries: test.retries,
+			},
+		}
+		kubeCluster.setClusterDefaults(context.Background())
+		sshOptions := kubeCluster.getSSHOptions()
+		assertEqual(t, sshOptions.Timeout, time.Duration(test.expectedTimeout)*time.Second, fmt.Sprintf("Failed to verify SSH timeout for [%s]", test.name))
+		assertEqual(t, sshOptions.Retries, test.expectedRetries, fmt.Sprintf("Failed to verify SSH retries for [%s]", test.name))
+		assertEqual(t, sshOptions.RetryBackoff, DefaultSSHRetryBackoff*time.Second, fmt.Sprintf("Failed to verify SSH retry backoff for [%s]", test.name))
+	}
+}
@@ -0,0 +1,101 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rancher/rke/backup"
+	"github.com/rancher/rke/docker"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/pki"
+	"github.com/rancher/rke/services"
+	"k8s.io/client-go/util/cert"
+)
+
+func (c *Cluster) SnapshotEtcd(ctx context.Context, snapshotName string) error {
+	if err := services.ValidateEtcdSnapshotName(snapshotName); err != nil {
+		return err
+	}
+	for _, host := range c.EtcdHosts {
+		if err := services.RunEtcdSnapshotSave(ctx, host, c.Services.Etcd, snapshotName, c.PrivateRegistriesMap); err != nil {
+			return err
+		}
+	}
+	if c.Services.Etcd.BackupTarget == nil {
+		return nil
+	}
+	// all etcd hosts hold the same data, one copy of the snapshot is enough
+	target, err := backup.NewTarget(*c.Services.Etcd.BackupTarget)
+	if err != nil {
+		return err
+	}
+	return services.UploadEtcdSnapshot(ctx, c.EtcdHosts[0], c.Services.Etcd, snapshotName, target, c.PrivateRegistriesMap)
+}
+
+func (c *Cluster) RestoreEtcdSnapshot(ctx context.Context, snapshotName string) error {
+	if err := services.ValidateEtcdSnapshotName(snapshotName); err != nil {
+		return err
+	}
+	// the cluster is rebuilt from the snapshot on the first etcd host, the other members join it empty
+	restoreHost := c.EtcdHosts[0]
+	if c.Services.Etcd.BackupTarget != nil {
+		target, err := backup.NewTarget(*c.Services.Etcd.BackupTarget)
+		if err != nil {
+			return err
+		}
+		if err := services.DownloadEtcdSnapshot(ctx, restoreHost, c.Services.Etcd, snapshotName, target, c.PrivateRegistriesMap); err != nil {
+			return err
+		}
+	}
+
+	// the API server is likely down when restoring, so we use the certificates backup on the etcd host
+	log.Infof(ctx, "[certificates] Fetching certificates backup from host [%s]", c.EtcdHosts[0].Address)
+	crtMap, err := pki.FetchCertificatesFromHost(ctx, c.EtcdHosts, c.EtcdHosts[0], c.SystemImages.Alpine, c.LocalKubeConfigPath, c.PrivateRegistriesMap)
+	if err != nil {
+		return err
+	}
+	if crtMap == nil {
+		return fmt.Errorf("No certificates backup found on host [%s]", c.EtcdHosts[0].Address)
+	}
+	clientCert := cert.EncodeCertPEM(crtMap[pki.KubeNodeCertName].Certificate)
+	clientKey := cert.EncodePrivateKeyPEM(crtMap[pki.KubeNodeCertName].Key)
+
+	// the snapshot is checked while etcd is still running, a missing snapshot leaves the cluster untouched
+	if err := services.CheckEtcdSnapshot(ctx, restoreHost, c.Services.Etcd, snapshotName, c.PrivateRegistriesMap); err != nil {
+		return err
+	}
+
+	// stop all etcd members before touching the data directories
+	for _, host := range c.EtcdHosts {
+		if err := docker.DoRemoveContainer(ctx, host.DClient, services.EtcdContainerName, host.Address); err != nil {
+			return err
+		}
+	}
+
+	// rebuild a single member cluster from the snapshot on the first etcd host
+	if err := services.RestoreEtcdSnapshot(ctx, restoreHost, c.Services.Etcd, snapshotName, c.PrivateRegistriesMap); err != nil {
+		return err
+	}
+	for _, host := range c.EtcdHosts[1:] {
+		if err := services.RemoveEtcdMemberData(ctx, host, c.Services.Etcd, c.PrivateRegistriesMap); err != nil {
+			return err
+		}
+		host.ToAddEtcdMember = true
+	}
+	if err := services.ReloadEtcdCluster(ctx, c.EtcdHosts, c.Services.Etcd, c.LocalConnDialerFactory, clientCert, clientKey, c.PrivateRegistriesMap); err != nil {
+		return err
+	}
+
+	// re-add the remaining members one at a time
+	for _, host := range c.EtcdHosts[1:] {
+		if err := services.AddEtcdMember(ctx, host, []*hosts.Host{restoreHost}, c.LocalConnDialerFactory, clientCert, clientKey); err != nil {
+			return err
+		}
+		host.ToAddEtcdMember = false
+		if err := services.ReloadEtcdCluster(ctx, c.EtcdHosts, c.Services.Etcd, c.LocalConnDialerFactory, clientCert, clientKey, c.PrivateRegistriesMap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,13 +2,17 @@ package cluster
 
 import (
 	"fmt"
+	"net"
+	"time"
 
 	"context"
 
 	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/k8s"
 	"github.com/rancher/rke/log"
 	"github.com/rancher/rke/pki"
 	"github.com/rancher/rke/services"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 )
@@ -45,6 +49,135 @@ func (c *Cluster) TunnelHosts(ctx context.Context, local bool) error {
 	return nil
 }
 
+// setUpKnownHosts loads the known_hosts file and the SSH host keys recorded in the local state file to verify the hosts,
+// the stored keys are used for the hosts that aren't recorded in the local state file
+func (c *Cluster) setUpKnownHosts(storedKeys map[string]string) error {
+	fullState, err := readStateFile(c.StateFilePath)
+	if err != nil {
+		return err
+	}
+	recordedKeys := map[string]string{}
+	for address, key := range storedKeys {
+		recordedKeys[address] = key
+	}
+	if fullState != nil {
+		for address, key := range fullState.HostKeys {
+			recordedKeys[address] = key
+		}
+	}
+	knownHosts, err := hosts.NewKnownHosts(c.SSHHostKeyChecking, []string{c.SSHKnownHostsPath}, recordedKeys)
+	if err != nil {
+		return err
+	}
+	if c.sshPool == nil {
+		c.sshPool = hosts.NewSSHPool()
+	}
+	c.setUpHostsSSH(knownHosts, c.BastionHost, c.sshPool)
+	return nil
+}
+
+// CloseSSHConnections closes the SSH connections to the hosts and the bastion hosts, which are kept open by the dialers
+func (c *Cluster) CloseSSHConnections() {
+	if c.sshPool != nil {
+		c.sshPool.Close()
+	}
+}
+
+// setUpHostsSSH sets the host key verification, the SSH pool and the bastion host of the hosts, the bastion_host of a node
+// overrides the cluster bastion host. The Kubernetes API is reached through the bastion host of the control plane hosts
+func (c *Cluster) setUpHostsSSH(knownHosts *hosts.KnownHosts, clusterBastionHost *v3.BastionHost, sshPool *hosts.SSHPool) {
+	c.knownHosts = knownHosts
+	c.sshPool = sshPool
+	sshOptions := c.getSSHOptions()
+	var clusterBastion *hosts.Bastion
+	if clusterBastionHost != nil {
+		clusterBastion = hosts.NewBastion(*clusterBastionHost, knownHosts, sshOptions, sshPool)
+	}
+	for _, host := range c.getUniqueHostList() {
+		host.KnownHosts = knownHosts
+		host.SSHOptions = sshOptions
+		host.SSHPool = sshPool
+		host.Bastion = clusterBastion
+		if host.BastionHost != nil {
+			host.Bastion = hosts.NewBastion(*host.BastionHost, knownHosts, sshOptions, sshPool)
+		}
+	}
+	c.K8sDialer = c.getK8sDialer(clusterBastion)
+}
+
+func (c *Cluster) getSSHOptions() hosts.SSHOptions {
+	return hosts.SSHOptions{
+		Timeout:         time.Duration(*c.SSHTimeout) * time.Second,
+		Retries:         *c.SSHRetries,
+		RetryBackoff:    time.Duration(*c.SSHRetryBackoff) * time.Second,
+		MaxRetryBackoff: time.Duration(*c.SSHMaxRetryBackoff) * time.Second,
+	}
+}
+
+func (c *Cluster) getK8sDialer(clusterBastion *hosts.Bastion) k8s.DialFunc {
+	bastions := map[string]*hosts.Bastion{}
+	for _, host := range c.ControlPlaneHosts {
+		if host.Bastion != nil {
+			bastions[host.Address] = host.Bastion
+		}
+	}
+	if len(bastions) == 0 {
+		return nil
+	}
+	return func(network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if bastion, ok := bastions[host]; ok {
+			return bastion.Dial(network, address)
+		}
+		if clusterBastion != nil {
+			return clusterBastion.Dial(network, address)
+		}
+		return net.Dial(network, address)
+	}
+}
+
+// loadStoredHostKeys adds the host keys saved in the state store to the known hosts
+func (c *Cluster) loadStoredHostKeys(ctx context.Context) error {
+	storedKeys, err := c.stateStore.GetHostKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to get SSH host keys from state store: %v", err)
+	}
+	if len(storedKeys) == 0 {
+		return nil
+	}
+	return c.setUpKnownHosts(storedKeys)
+}
+
+// SaveHostKeys records the SSH host keys trusted on first use in the local state file and in the state store. It is
+// called by the commands changing the cluster once the hosts are tunneled, the dry runs never save them
+func (c *Cluster) SaveHostKeys(ctx context.Context) error {
+	if c.knownHosts == nil {
+		return nil
+	}
+	newKeys := c.knownHosts.NewHostKeys()
+	if len(newKeys) == 0 {
+		return nil
+	}
+	for address, key := range newKeys {
+		log.Warnf(ctx, "[ssh] Trusting SSH host key of host [%s] on first use: %s", address, key)
+	}
+	hostKeys := c.knownHosts.HostKeys()
+	localStore := &fileStateStore{path: c.StateFilePath}
+	if err := localStore.SaveHostKeys(ctx, hostKeys); err != nil {
+		return fmt.Errorf("Failed to record SSH host keys: %v", err)
+	}
+	if c.stateStore == nil {
+		return nil
+	}
+	if err := c.stateStore.SaveHostKeys(ctx, hostKeys); err != nil {
+		return fmt.Errorf("Failed to save SSH host keys to state store: %v", err)
+	}
+	return nil
+}
+
 func (c *Cluster) InvertIndexHosts() error {
 	c.EtcdHosts = make([]*hosts.Host, 0)
 	c.WorkerHosts = make([]*hosts.Host, 0)
@@ -90,6 +223,10 @@ func (c *Cluster) InvertIndexHosts() error {
 		if !newHost.IsWorker {
 			newHost.ToDelLabels[workerRoleLabel] = "true"
 		}
+		if newHost.IsEtcd && !newHost.IsControl && !newHost.IsWorker {
+			// Add unschedulable taint, it's synced with the labels even if the worker plane phase is skipped
+			newHost.ToAddTaints = append(newHost.ToAddTaints, unschedulableEtcdTaint)
+		}
 	}
 	return nil
 }
@@ -101,9 +238,15 @@ func (c *Cluster) SetUpHosts(ctx context.Context) error {
 		var errgrp errgroup.Group
 
 		for _, host := range hosts {
+			if c.checkpoint.isHostCompleted(PhaseCertificates, host.Address) {
+				continue
+			}
 			runHost := host
 			errgrp.Go(func() error {
-				return pki.DeployCertificatesOnPlaneHost(ctx, runHost, c.EtcdHosts, c.Certificates, c.SystemImages.CertDownloader, c.PrivateRegistriesMap)
+				if err := pki.DeployCertificatesOnPlaneHost(ctx, runHost, c.EtcdHosts, c.Certificates, c.SystemImages.CertDownloader, c.PrivateRegistriesMap); err != nil {
+					return err
+				}
+				return c.checkpoint.completeHost(PhaseCertificates, runHost.Address)
 			})
 		}
 		if err := errgrp.Wait(); err != nil {
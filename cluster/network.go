@@ -98,21 +98,29 @@ const (
 
 func (c *Cluster) DeployNetworkPlugin(ctx context.Context) error {
 	log.Infof(ctx, "[network] Setting up network plugin: %s", c.Network.Plugin)
+	pluginYaml, err := c.getNetworkPluginYaml()
+	if err != nil {
+		return err
+	}
+	return c.doAddonDeploy(ctx, pluginYaml, NetworkPluginResourceName)
+}
+
+func (c *Cluster) getNetworkPluginYaml() (string, error) {
 	switch c.Network.Plugin {
 	case FlannelNetworkPlugin:
-		return c.doFlannelDeploy(ctx)
+		return c.getFlannelYaml()
 	case CalicoNetworkPlugin:
-		return c.doCalicoDeploy(ctx)
+		return c.getCalicoYaml()
 	case CanalNetworkPlugin:
-		return c.doCanalDeploy(ctx)
+		return c.getCanalYaml()
 	case WeaveNetworkPlugin:
-		return c.doWeaveDeploy(ctx)
+		return c.getWeaveYaml()
 	default:
-		return fmt.Errorf("[network] Unsupported network plugin: %s", c.Network.Plugin)
+		return "", fmt.Errorf("[network] Unsupported network plugin: %s", c.Network.Plugin)
 	}
 }
 
-func (c *Cluster) doFlannelDeploy(ctx context.Context) error {
+func (c *Cluster) getFlannelYaml() (string, error) {
 	flannelConfig := map[string]string{
 		ClusterCIDR:      c.ClusterCIDR,
 		Image:            c.SystemImages.Flannel,
@@ -120,14 +128,10 @@ func (c *Cluster) doFlannelDeploy(ctx context.Context) error {
 		FlannelInterface: c.Network.Options[FlannelIface],
 		RBACConfig:       c.Authorization.Mode,
 	}
-	pluginYaml, err := c.getNetworkPluginManifest(flannelConfig)
-	if err != nil {
-		return err
-	}
-	return c.doAddonDeploy(ctx, pluginYaml, NetworkPluginResourceName)
+	return c.getNetworkPluginManifest(flannelConfig)
 }
 
-func (c *Cluster) doCalicoDeploy(ctx context.Context) error {
+func (c *Cluster) getCalicoYaml() (string, error) {
 	clientCert := b64.StdEncoding.EncodeToString(cert.EncodeCertPEM(c.Certificates[pki.KubeNodeCertName].Certificate))
 	clientkey := b64.StdEncoding.EncodeToString(cert.EncodePrivateKeyPEM(c.Certificates[pki.KubeNodeCertName].Key))
 	clientConfig := pki.GetConfigPath(pki.KubeNodeCertName)
@@ -150,14 +154,10 @@ func (c *Cluster) doCalicoDeploy(ctx context.Context) error {
 		CloudProvider:    c.Network.Options[CalicoCloudProvider],
 		RBACConfig:       c.Authorization.Mode,
 	}
-	pluginYaml, err := c.getNetworkPluginManifest(calicoConfig)
-	if err != nil {
-		return err
-	}
-	return c.doAddonDeploy(ctx, pluginYaml, NetworkPluginResourceName)
+	return c.getNetworkPluginManifest(calicoConfig)
 }
 
-func (c *Cluster) doCanalDeploy(ctx context.Context) error {
+func (c *Cluster) getCanalYaml() (string, error) {
 	clientConfig := pki.GetConfigPath(pki.KubeNodeCertName)
 	canalConfig := map[string]string{
 		ClientCertPath:  pki.GetCertPath(pki.KubeNodeCertName),
@@ -171,25 +171,17 @@ func (c *Cluster) doCanalDeploy(ctx context.Context) error {
 		CanalFlannelImg: c.SystemImages.CanalFlannel,
 		RBACConfig:      c.Authorization.Mode,
 	}
-	pluginYaml, err := c.getNetworkPluginManifest(canalConfig)
-	if err != nil {
-		return err
-	}
-	return c.doAddonDeploy(ctx, pluginYaml, NetworkPluginResourceName)
+	return c.getNetworkPluginManifest(canalConfig)
 }
 
-func (c *Cluster) doWeaveDeploy(ctx context.Context) error {
+func (c *Cluster) getWeaveYaml() (string, error) {
 	weaveConfig := map[string]string{
 		ClusterCIDR: c.ClusterCIDR,
 		Image:       c.SystemImages.WeaveNode,
 		CNIImage:    c.SystemImages.WeaveCNI,
 		RBACConfig:  c.Authorization.Mode,
 	}
-	pluginYaml, err := c.getNetworkPluginManifest(weaveConfig)
-	if err != nil {
-		return err
-	}
-	return c.doAddonDeploy(ctx, pluginYaml, NetworkPluginResourceName)
+	return c.getNetworkPluginManifest(weaveConfig)
 }
 
 func (c *Cluster) getNetworkPluginManifest(pluginConfig map[string]string) (string, error) {
@@ -237,7 +229,11 @@ func (c *Cluster) checkKubeAPIPort(ctx context.Context) error {
 	for _, host := range c.ControlPlaneHosts {
 		logrus.Debugf("[network] Checking KubeAPI port [%s] on host: %s", KubeAPIPort, host.Address)
 		address := fmt.Sprintf("%s:%s", host.Address, KubeAPIPort)
-		conn, err := net.Dial("tcp", address)
+		dial := net.Dial
+		if host.Bastion != nil {
+			dial = host.Bastion.Dial
+		}
+		conn, err := dial("tcp", address)
 		if err != nil {
 			return fmt.Errorf("[network] Can't access KubeAPI port [%s] on Control Plane host: %s", KubeAPIPort, host.Address)
 		}
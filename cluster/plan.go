@@ -0,0 +1,313 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rancher/rke/docker"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/k8s"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/pki"
+	"github.com/rancher/rke/services"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	PlanActionAdd     = "add"
+	PlanActionRemove  = "remove"
+	PlanActionCreate  = "create"
+	PlanActionUpgrade = "upgrade"
+	PlanActionUpdate  = "update"
+)
+
+// Plan describes the changes rke up would apply to the cluster
+type Plan struct {
+	Hosts        []HostChange
+	Containers   []ContainerChange
+	Addons       []AddonChange
+	Certificates []CertificateChange
+	HostKeys     []HostKeyChange
+}
+
+type HostChange struct {
+	Address string
+	Role    string
+	Action  string
+}
+
+type ContainerChange struct {
+	Host        string
+	Name        string
+	Action      string
+	OldImage    string
+	NewImage    string
+	RemovedArgs []string
+	AddedArgs   []string
+}
+
+type AddonChange struct {
+	Name   string
+	Action string
+}
+
+type CertificateChange struct {
+	Name   string
+	Reason string
+}
+
+// HostKeyChange is an SSH host key that rke up would trust on first use and record in the cluster state
+type HostKeyChange struct {
+	Address string
+	Key     string
+}
+
+// GetClusterPlan builds the execution plan of rke up, it only inspects the hosts and the cluster and never changes them
+func GetClusterPlan(ctx context.Context, kubeCluster *Cluster) (*Plan, error) {
+	plan := &Plan{}
+	currentCluster, err := kubeCluster.getCurrentClusterReadOnly(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if currentCluster != nil {
+		kubeCluster.Certificates = currentCluster.Certificates
+		plan.Hosts = getHostsPlan(currentCluster, kubeCluster)
+	} else {
+		for _, host := range kubeCluster.getUniqueHostList() {
+			plan.Hosts = append(plan.Hosts, HostChange{host.Address, strings.Join(host.Role, ","), PlanActionAdd})
+		}
+	}
+	plan.Certificates = getCertificatesPlan(currentCluster, kubeCluster)
+
+	if plan.Containers, err = getContainersPlan(ctx, kubeCluster); err != nil {
+		return nil, err
+	}
+	if currentCluster != nil {
+		if plan.Addons, err = getAddonsPlan(kubeCluster); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, addonName := range kubeCluster.getAddonNames() {
+			plan.Addons = append(plan.Addons, AddonChange{addonName, PlanActionCreate})
+		}
+	}
+	plan.HostKeys = kubeCluster.getHostKeysPlan()
+	return plan, nil
+}
+
+// getHostKeysPlan returns the host keys trusted on first use while tunneling the hosts, they aren't saved by the plan
+func (c *Cluster) getHostKeysPlan() []HostKeyChange {
+	if c.knownHosts == nil {
+		return nil
+	}
+	changes := []HostKeyChange{}
+	for address, key := range c.knownHosts.NewHostKeys() {
+		changes = append(changes, HostKeyChange{address, key})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Address < changes[j].Address
+	})
+	return changes
+}
+
+// getCurrentClusterReadOnly builds the current cluster like GetClusterState, from the local state file and the state store,
+// but doesn't restore or rebuild the local kube config
+func (c *Cluster) getCurrentClusterReadOnly(ctx context.Context) (*Cluster, error) {
+	fileCluster, err := c.getStateFromFile(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(c.LocalKubeConfigPath); os.IsNotExist(err) {
+		if fileCluster != nil {
+			log.Infof(ctx, "[plan] Local kube config file not found, rke up would restore it from local state file [%s]", c.StateFilePath)
+		}
+	} else if _, err := GetK8sVersion(c.LocalKubeConfigPath, c.K8sDialer); err != nil {
+		log.Warnf(ctx, "[plan] Failed to connect to the cluster using local kube config [%s], rke up would rebuild it: %v", c.LocalKubeConfigPath, err)
+	} else if c.KubeClient, err = k8s.NewClient(c.LocalKubeConfigPath, c.K8sDialer); err != nil {
+		return nil, fmt.Errorf("Failed to initiate new Kubernetes Client: %v", err)
+	}
+	storeCluster, err := c.getCurrentCluster(ctx)
+	if err != nil {
+		if fileCluster == nil {
+			return nil, err
+		}
+		log.Warnf(ctx, "[state] Failed to get cluster state from state store: %v", err)
+	}
+	currentCluster := reconcileClusterStates(ctx, c.StateFilePath, fileCluster, storeCluster)
+	if currentCluster != nil {
+		currentCluster.Certificates, err = regenerateAPICertificate(c, currentCluster.Certificates)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to regenerate KubeAPI certificate %v", err)
+		}
+	}
+	return currentCluster, nil
+}
+
+func getHostsPlan(currentCluster, kubeCluster *Cluster) []HostChange {
+	changes := []HostChange{}
+	roleHosts := []struct {
+		role                      string
+		currentHosts, configHosts []*hosts.Host
+	}{
+		{services.ETCDRole, currentCluster.EtcdHosts, kubeCluster.EtcdHosts},
+		{services.ControlRole, currentCluster.ControlPlaneHosts, kubeCluster.ControlPlaneHosts},
+		{services.WorkerRole, currentCluster.WorkerHosts, kubeCluster.WorkerHosts},
+	}
+	for _, roleHost := range roleHosts {
+		for _, host := range hosts.GetToDeleteHosts(roleHost.currentHosts, roleHost.configHosts) {
+			changes = append(changes, HostChange{host.Address, roleHost.role, PlanActionRemove})
+		}
+		for _, host := range hosts.GetToAddHosts(roleHost.currentHosts, roleHost.configHosts) {
+			changes = append(changes, HostChange{host.Address, roleHost.role, PlanActionAdd})
+		}
+	}
+	return changes
+}
+
+func getCertificatesPlan(currentCluster, kubeCluster *Cluster) []CertificateChange {
+	if kubeCluster.Authentication.Strategy != X509AuthenticationProvider {
+		return nil
+	}
+	if currentCluster == nil {
+		reason := "generated, unless a certificates backup exists on etcd host " + kubeCluster.EtcdHosts[0].Address
+		if len(kubeCluster.CustomCertsDir) > 0 {
+			reason = "loaded from custom certificates directory " + kubeCluster.CustomCertsDir
+		}
+		return []CertificateChange{{"all", reason}}
+	}
+	changes := []CertificateChange{
+		{pki.KubeAPICertName, "reissued with the current control plane hosts SANs"},
+	}
+	for _, host := range hosts.GetToAddHosts(currentCluster.EtcdHosts, kubeCluster.EtcdHosts) {
+		changes = append(changes, CertificateChange{pki.GetEtcdCrtName(host.InternalAddress), "generated for new etcd host " + host.Address})
+	}
+	return changes
+}
+
+func getContainersPlan(ctx context.Context, kubeCluster *Cluster) ([]ContainerChange, error) {
+	changes := []ContainerChange{}
+	for _, host := range kubeCluster.getUniqueHostList() {
+		desiredContainers, err := services.GetHostContainersConfig(host,
+			kubeCluster.ControlPlaneHosts,
+			kubeCluster.EtcdHosts,
+			kubeCluster.Services,
+			kubeCluster.SystemImages.NginxProxy,
+			kubeCluster.Authorization.Mode)
+		if err != nil {
+			return nil, err
+		}
+		desiredNames := []string{}
+		for _, desired := range desiredContainers {
+			desiredNames = append(desiredNames, desired.Name)
+			exists, err := docker.IsContainerRunning(ctx, host.DClient, host.Address, desired.Name, true)
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				changes = append(changes, ContainerChange{Host: host.Address, Name: desired.Name, Action: PlanActionCreate, NewImage: desired.Image.Image})
+				continue
+			}
+			upgradable, err := docker.IsContainerUpgradable(ctx, host.DClient, desired.Image, desired.Name, host.Address, desired.Plane)
+			if err != nil {
+				return nil, err
+			}
+			if !upgradable {
+				continue
+			}
+			containerInspect, err := docker.InspectContainer(ctx, host.DClient, host.Address, desired.Name)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, ContainerChange{
+				Host:        host.Address,
+				Name:        desired.Name,
+				Action:      PlanActionUpgrade,
+				OldImage:    containerInspect.Config.Image,
+				NewImage:    desired.Image.Image,
+				RemovedArgs: getMissingArgs(containerInspect.Config.Cmd, desired.Image.Cmd),
+				AddedArgs:   getMissingArgs(desired.Image.Cmd, containerInspect.Config.Cmd),
+			})
+		}
+		for _, containerName := range services.ServiceContainerNames {
+			if isStringInSlice(containerName, desiredNames) {
+				continue
+			}
+			exists, err := docker.IsContainerRunning(ctx, host.DClient, host.Address, containerName, true)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				changes = append(changes, ContainerChange{Host: host.Address, Name: containerName, Action: PlanActionRemove})
+			}
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Host < changes[j].Host
+	})
+	return changes, nil
+}
+
+// getMissingArgs returns the args found in a and missing from b
+func getMissingArgs(a, b []string) []string {
+	missing := []string{}
+	for _, arg := range a {
+		if !isStringInSlice(arg, b) {
+			missing = append(missing, arg)
+		}
+	}
+	return missing
+}
+
+func (c *Cluster) getAddonNames() []string {
+	addonNames := []string{NetworkPluginResourceName, KubeDNSAddonResourceName}
+	if c.Ingress.Provider != "none" {
+		addonNames = append(addonNames, IngressAddonResourceName)
+	}
+	if c.Addons != "" {
+		addonNames = append(addonNames, UserAddonResourceName)
+	}
+	return addonNames
+}
+
+func getAddonsPlan(kubeCluster *Cluster) ([]AddonChange, error) {
+	changes := []AddonChange{}
+	if kubeCluster.KubeClient == nil {
+		// the addon ConfigMaps can't be compared without the Kubernetes API, rke up applies all the addons
+		for _, addonName := range kubeCluster.getAddonNames() {
+			changes = append(changes, AddonChange{addonName, PlanActionUpdate})
+		}
+		return changes, nil
+	}
+	for _, addonName := range kubeCluster.getAddonNames() {
+		var addonYaml string
+		var err error
+		switch addonName {
+		case NetworkPluginResourceName:
+			addonYaml, err = kubeCluster.getNetworkPluginYaml()
+		case KubeDNSAddonResourceName:
+			addonYaml, err = kubeCluster.getKubeDNSYaml()
+		case IngressAddonResourceName:
+			addonYaml, err = kubeCluster.getIngressYaml()
+		case UserAddonResourceName:
+			addonYaml = kubeCluster.Addons
+		}
+		if err != nil {
+			return nil, err
+		}
+		configMap, err := k8s.GetConfigMap(kubeCluster.KubeClient, addonName)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				changes = append(changes, AddonChange{addonName, PlanActionCreate})
+				continue
+			}
+			return nil, fmt.Errorf("Failed to get addon ConfigMap [%s]: %v", addonName, err)
+		}
+		if configMap.Data[addonName] != addonYaml {
+			changes = append(changes, AddonChange{addonName, PlanActionUpdate})
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,63 @@
+package cluster
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+)
+
+const TestPlanServiceIP = "10.43.0.1"
+
+func TestGetCurrentClusterReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rke-plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rkeConfig := v3.RancherKubernetesEngineConfig{
+		Nodes: []v3.RKEConfigNode{
+			{Address: "1.1.1.1", Role: []string{"etcd", "controlplane", "worker"}},
+		},
+		SSHKeyPath: TestStateSSHKeyPath,
+	}
+	kubeCluster := &Cluster{
+		RancherKubernetesEngineConfig: rkeConfig,
+		StateFilePath:                 filepath.Join(dir, "cluster.rkestate"),
+		LocalKubeConfigPath:           filepath.Join(dir, "kube_config_cluster.yml"),
+		KubernetesServiceIP:           net.ParseIP(TestPlanServiceIP),
+		stateStore:                    &fileStateStore{path: filepath.Join(dir, "remote.rkestate")},
+	}
+	if err := kubeCluster.InvertIndexHosts(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	currentCluster, err := kubeCluster.getCurrentClusterReadOnly(ctx)
+	assertEqual(t, err == nil && currentCluster == nil, true, "Failed to plan a new cluster without state")
+
+	// the state store has no state yet, rke up would use the local state file and restore the kube config from it
+	localStore := &fileStateStore{path: kubeCluster.StateFilePath}
+	if err := localStore.SaveState(ctx, &rkeConfig, getTestStateCertificates(t)); err != nil {
+		t.Fatal(err)
+	}
+	currentCluster, err = kubeCluster.getCurrentClusterReadOnly(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get current cluster: %v", err)
+	}
+	assertEqual(t, currentCluster != nil && currentCluster.SSHKeyPath == TestStateSSHKeyPath, true, "Failed to get current cluster from local state file")
+	_, err = os.Stat(kubeCluster.LocalKubeConfigPath)
+	assertEqual(t, os.IsNotExist(err), true, "Failed to skip writing the local kube config")
+
+	addons, err := getAddonsPlan(kubeCluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, addon := range addons {
+		assertEqual(t, addon.Action, PlanActionUpdate, "Failed to plan addon update without the Kubernetes API")
+	}
+}
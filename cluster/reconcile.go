@@ -27,7 +27,7 @@ func ReconcileCluster(ctx context.Context, kubeCluster, currentCluster *Cluster)
 		return nil
 	}
 
-	kubeClient, err := k8s.NewClient(kubeCluster.LocalKubeConfigPath)
+	kubeClient, err := k8s.NewClient(kubeCluster.LocalKubeConfigPath, kubeCluster.K8sDialer)
 	if err != nil {
 		return fmt.Errorf("Failed to initialize new kubernetes client: %v", err)
 	}
@@ -55,8 +55,8 @@ func reconcileWorker(ctx context.Context, currentCluster, kubeCluster *Cluster,
 	wpToDelete := hosts.GetToDeleteHosts(currentCluster.WorkerHosts, kubeCluster.WorkerHosts)
 	for _, toDeleteHost := range wpToDelete {
 		toDeleteHost.IsWorker = false
-		if err := hosts.DeleteNode(ctx, toDeleteHost, kubeClient, toDeleteHost.IsControl); err != nil {
-			return fmt.Errorf("Failed to delete worker node %s from cluster", toDeleteHost.Address)
+		if err := hosts.DeleteNode(ctx, toDeleteHost, kubeClient, toDeleteHost.IsControl, kubeCluster.NodeDrain, kubeCluster.SkipDrain); err != nil {
+			return fmt.Errorf("Failed to delete worker node %s from cluster: %v", toDeleteHost.Address, err)
 		}
 		// attempting to clean services/files on the host
 		if err := reconcileHost(ctx, toDeleteHost, true, false, currentCluster.SystemImages.Alpine, currentCluster.DockerDialerFactory, currentCluster.PrivateRegistriesMap); err != nil {
@@ -90,12 +90,12 @@ func reconcileControl(ctx context.Context, currentCluster, kubeCluster *Cluster,
 	}
 
 	for _, toDeleteHost := range cpToDelete {
-		kubeClient, err := k8s.NewClient(kubeCluster.LocalKubeConfigPath)
+		kubeClient, err := k8s.NewClient(kubeCluster.LocalKubeConfigPath, kubeCluster.K8sDialer)
 		if err != nil {
 			return fmt.Errorf("Failed to initialize new kubernetes client: %v", err)
 		}
-		if err := hosts.DeleteNode(ctx, toDeleteHost, kubeClient, toDeleteHost.IsWorker); err != nil {
-			return fmt.Errorf("Failed to delete controlplane node %s from cluster", toDeleteHost.Address)
+		if err := hosts.DeleteNode(ctx, toDeleteHost, kubeClient, toDeleteHost.IsWorker, kubeCluster.NodeDrain, kubeCluster.SkipDrain); err != nil {
+			return fmt.Errorf("Failed to delete controlplane node %s from cluster: %v", toDeleteHost.Address, err)
 		}
 		// attempting to clean services/files on the host
 		if err := reconcileHost(ctx, toDeleteHost, false, false, currentCluster.SystemImages.Alpine, currentCluster.DockerDialerFactory, currentCluster.PrivateRegistriesMap); err != nil {
@@ -153,12 +153,28 @@ func reconcileEtcd(ctx context.Context, currentCluster, kubeCluster *Cluster, ku
 	clientkey := cert.EncodePrivateKeyPEM(currentCluster.Certificates[pki.KubeNodeCertName].Key)
 
 	etcdToDelete := hosts.GetToDeleteHosts(currentCluster.EtcdHosts, kubeCluster.EtcdHosts)
+	etcdToAdd := hosts.GetToAddHosts(currentCluster.EtcdHosts, kubeCluster.EtcdHosts)
+	if len(etcdToDelete) > 0 || len(etcdToAdd) > 0 {
+		var err error
+		if etcdToDelete, err = checkEtcdMembershipChange(ctx, currentCluster, kubeCluster, etcdToDelete, clientCert, clientkey); err != nil {
+			return err
+		}
+	}
+	// the members that stay in the cluster are used to check the etcd health after each removal
+	remainingEtcdHosts := []*hosts.Host{}
+	for _, host := range kubeCluster.EtcdHosts {
+		if !isHostInList(host, etcdToAdd) {
+			remainingEtcdHosts = append(remainingEtcdHosts, host)
+		}
+	}
 	for _, etcdHost := range etcdToDelete {
 		if err := services.RemoveEtcdMember(ctx, etcdHost, kubeCluster.EtcdHosts, currentCluster.LocalConnDialerFactory, clientCert, clientkey); err != nil {
-			log.Warnf(ctx, "[reconcile] %v", err)
-			continue
+			return err
+		}
+		if err := services.CheckEtcdClusterHealth(ctx, remainingEtcdHosts, currentCluster.LocalConnDialerFactory, clientCert, clientkey); err != nil {
+			return fmt.Errorf("Etcd cluster is not healthy after removing member [etcd-%s], stopping etcd reconciliation: %v", etcdHost.HostnameOverride, err)
 		}
-		if err := hosts.DeleteNode(ctx, etcdHost, kubeClient, etcdHost.IsControl); err != nil {
+		if err := hosts.DeleteNode(ctx, etcdHost, kubeClient, etcdHost.IsControl, kubeCluster.NodeDrain, kubeCluster.SkipDrain); err != nil {
 			log.Warnf(ctx, "Failed to delete etcd node %s from cluster", etcdHost.Address)
 			continue
 		}
@@ -169,7 +185,6 @@ func reconcileEtcd(ctx context.Context, currentCluster, kubeCluster *Cluster, ku
 		}
 	}
 	log.Infof(ctx, "[reconcile] Check etcd hosts to be added")
-	etcdToAdd := hosts.GetToAddHosts(currentCluster.EtcdHosts, kubeCluster.EtcdHosts)
 	crtMap := currentCluster.Certificates
 	var err error
 	for _, etcdHost := range etcdToAdd {
@@ -200,10 +215,58 @@ func reconcileEtcd(ctx context.Context, currentCluster, kubeCluster *Cluster, ku
 		if err := services.ReloadEtcdCluster(ctx, kubeCluster.EtcdHosts, kubeCluster.Services.Etcd, currentCluster.LocalConnDialerFactory, clientCert, clientkey, currentCluster.PrivateRegistriesMap); err != nil {
 			return err
 		}
+		if err := services.CheckEtcdClusterHealth(ctx, kubeCluster.EtcdHosts, currentCluster.LocalConnDialerFactory, clientCert, clientkey); err != nil {
+			return fmt.Errorf("Etcd cluster is not healthy after adding member [etcd-%s], stopping etcd reconciliation: %v", etcdHost.HostnameOverride, err)
+		}
 	}
 	return nil
 }
 
+// checkEtcdMembershipChange refuses membership changes that would break the etcd quorum, unless forced.
+// It returns the hosts to delete with the unhealthy members first, since removing them doesn't reduce the healthy members
+func checkEtcdMembershipChange(ctx context.Context, currentCluster, kubeCluster *Cluster, etcdToDelete []*hosts.Host, clientCert, clientKey []byte) ([]*hosts.Host, error) {
+	membersStatus := services.GetEtcdMembersStatus(ctx, currentCluster.EtcdHosts, currentCluster.LocalConnDialerFactory, clientCert, clientKey)
+	healthyMembers := map[string]bool{}
+	for _, memberStatus := range membersStatus {
+		if memberStatus.Healthy {
+			healthyMembers[memberStatus.Host] = true
+		}
+	}
+	orderedToDelete := []*hosts.Host{}
+	toDeleteHealthy := 0
+	for _, host := range etcdToDelete {
+		if !healthyMembers[host.Address] {
+			orderedToDelete = append(orderedToDelete, host)
+		}
+	}
+	for _, host := range etcdToDelete {
+		if healthyMembers[host.Address] {
+			orderedToDelete = append(orderedToDelete, host)
+			toDeleteHealthy++
+		}
+	}
+	err := services.ValidateEtcdMembershipChange(len(currentCluster.EtcdHosts), len(healthyMembers), len(etcdToDelete), toDeleteHealthy)
+	if err == nil {
+		return orderedToDelete, nil
+	}
+	if kubeCluster.ForceMembershipChange {
+		log.Warnf(ctx, "[reconcile] Forcing etcd membership change: %v", err)
+		return orderedToDelete, nil
+	}
+	return nil, fmt.Errorf("Refusing to change etcd membership: %v. To change etcd members safely, make sure the etcd cluster is healthy, "+
+		"then add or remove one etcd host at a time and run rke up after each change, removing unhealthy members first. "+
+		"Use --force to apply the change anyway, at the risk of losing the etcd quorum", err)
+}
+
+func isHostInList(host *hosts.Host, hostList []*hosts.Host) bool {
+	for _, h := range hostList {
+		if h.Address == host.Address {
+			return true
+		}
+	}
+	return false
+}
+
 func syncLabels(ctx context.Context, currentCluster, kubeCluster *Cluster) {
 	currentHosts := currentCluster.getUniqueHostList()
 	configHosts := kubeCluster.getUniqueHostList()
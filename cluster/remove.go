@@ -31,6 +31,7 @@ func (c *Cluster) ClusterRemove(ctx context.Context) error {
 	}
 
 	pki.RemoveAdminConfig(ctx, c.LocalKubeConfigPath)
+	c.removeStateFile(ctx)
 	return nil
 }
 
@@ -8,74 +8,108 @@ import (
 
 	"github.com/rancher/rke/k8s"
 	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/pki"
 	"github.com/rancher/types/apis/management.cattle.io/v3"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/kubernetes"
 )
 
 func (c *Cluster) SaveClusterState(ctx context.Context, rkeConfig *v3.RancherKubernetesEngineConfig) error {
-	// Reinitialize kubernetes Client
-	var err error
-	c.KubeClient, err = k8s.NewClient(c.LocalKubeConfigPath)
-	if err != nil {
-		return fmt.Errorf("Failed to re-initialize Kubernetes Client: %v", err)
+	// Save the local state file first, so the state isn't lost if the state store is not reachable
+	if err := c.saveCurrentState(ctx, rkeConfig); err != nil {
+		return fmt.Errorf("[state] Failed to save local state file: %v", err)
+	}
+	if err := c.stateStore.SaveState(ctx, rkeConfig, c.Certificates); err != nil {
+		return fmt.Errorf("[state] Failed to save cluster state: %v", err)
 	}
-	err = saveClusterCerts(ctx, c.KubeClient, c.Certificates)
+	return nil
+}
+
+// GetClusterState gets the current cluster from the local state file and from the state store, preferring the local state file
+func (c *Cluster) GetClusterState(ctx context.Context) (*Cluster, error) {
+	fileCluster, err := c.getStateFromFile(ctx)
 	if err != nil {
-		return fmt.Errorf("[certificates] Failed to Save Kubernetes certificates: %v", err)
+		return nil, err
+	}
+	if err := c.setUpLocalKubeConfig(ctx, fileCluster); err != nil {
+		return nil, err
 	}
-	err = saveStateToKubernetes(ctx, c.KubeClient, c.LocalKubeConfigPath, rkeConfig)
+	storeCluster, err := c.getCurrentCluster(ctx)
 	if err != nil {
-		return fmt.Errorf("[state] Failed to save configuration state: %v", err)
+		if fileCluster == nil {
+			return nil, err
+		}
+		log.Warnf(ctx, "[state] Failed to get cluster state from state store: %v", err)
 	}
-	return nil
+	currentCluster := reconcileClusterStates(ctx, c.StateFilePath, fileCluster, storeCluster)
+	if currentCluster != nil {
+		currentCluster.Certificates, err = regenerateAPICertificate(c, currentCluster.Certificates)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to regenerate KubeAPI certificate %v", err)
+		}
+	}
+	return currentCluster, nil
 }
 
-func (c *Cluster) GetClusterState(ctx context.Context) (*Cluster, error) {
+func (c *Cluster) setUpLocalKubeConfig(ctx context.Context, fileCluster *Cluster) error {
 	var err error
-	var currentCluster *Cluster
-
-	// check if local kubeconfig file exists
-	if _, err = os.Stat(c.LocalKubeConfigPath); !os.IsNotExist(err) {
-		log.Infof(ctx, "[state] Found local kube config file, trying to get state from cluster")
-
-		// to handle if current local admin is down and we need to use new cp from the list
-		if !isLocalConfigWorking(ctx, c.LocalKubeConfigPath) {
-			if err := rebuildLocalAdminConfig(ctx, c); err != nil {
-				return nil, err
+	// the local kube config can be restored from the local state file
+	if _, err = os.Stat(c.LocalKubeConfigPath); os.IsNotExist(err) && fileCluster != nil {
+		if adminConfig := fileCluster.Certificates[pki.KubeAdminCertName].Config; len(adminConfig) > 0 {
+			log.Infof(ctx, "[state] Restoring local kube config file from local state file")
+			if err := pki.DeployAdminConfig(ctx, adminConfig, c.LocalKubeConfigPath); err != nil {
+				return err
 			}
 		}
+	}
+	// check if local kubeconfig file exists
+	if _, err = os.Stat(c.LocalKubeConfigPath); os.IsNotExist(err) {
+		return nil
+	}
+	log.Infof(ctx, "[state] Found local kube config file, trying to get state from cluster")
 
-		// initiate kubernetes client
-		c.KubeClient, err = k8s.NewClient(c.LocalKubeConfigPath)
-		if err != nil {
-			log.Warnf(ctx, "Failed to initiate new Kubernetes Client: %v", err)
-			return nil, nil
+	// to handle if current local admin is down and we need to use new cp from the list
+	if !isLocalConfigWorking(ctx, c.LocalKubeConfigPath, c.K8sDialer) {
+		if err := rebuildLocalAdminConfig(ctx, c); err != nil {
+			return err
 		}
-		// Get previous kubernetes state
-		currentCluster = getStateFromKubernetes(ctx, c.KubeClient, c.LocalKubeConfigPath)
-		// Get previous kubernetes certificates
-		if currentCluster != nil {
-			if err := currentCluster.InvertIndexHosts(); err != nil {
-				return nil, fmt.Errorf("Failed to classify hosts from fetched cluster: %v", err)
-			}
-			currentCluster.Certificates, err = getClusterCerts(ctx, c.KubeClient, currentCluster.EtcdHosts)
-			currentCluster.DockerDialerFactory = c.DockerDialerFactory
-			currentCluster.LocalConnDialerFactory = c.LocalConnDialerFactory
-			if err != nil {
-				return nil, fmt.Errorf("Failed to Get Kubernetes certificates: %v", err)
-			}
-			// setting cluster defaults for the fetched cluster as well
-			currentCluster.setClusterDefaults(ctx)
+	}
 
-			currentCluster.Certificates, err = regenerateAPICertificate(c, currentCluster.Certificates)
-			if err != nil {
-				return nil, fmt.Errorf("Failed to regenerate KubeAPI certificate %v", err)
-			}
-		}
+	// initiate kubernetes client
+	c.KubeClient, err = k8s.NewClient(c.LocalKubeConfigPath, c.K8sDialer)
+	if err != nil {
+		log.Warnf(ctx, "Failed to initiate new Kubernetes Client: %v", err)
+	}
+	return nil
+}
+
+// getCurrentCluster fetches the previous state and certificates from the state store
+func (c *Cluster) getCurrentCluster(ctx context.Context) (*Cluster, error) {
+	// Get previous state
+	rkeConfig, err := c.stateStore.GetConfig(ctx)
+	if err != nil || rkeConfig == nil {
+		return nil, err
+	}
+	currentCluster := &Cluster{
+		RancherKubernetesEngineConfig: *rkeConfig,
+	}
+	// Get previous certificates
+	if err := currentCluster.InvertIndexHosts(); err != nil {
+		return nil, fmt.Errorf("Failed to classify hosts from fetched cluster: %v", err)
 	}
+	currentCluster.Certificates, err = c.stateStore.GetCertificates(ctx, currentCluster.EtcdHosts)
+	currentCluster.DockerDialerFactory = c.DockerDialerFactory
+	currentCluster.LocalConnDialerFactory = c.LocalConnDialerFactory
+	if err != nil {
+		return nil, fmt.Errorf("Failed to Get Kubernetes certificates: %v", err)
+	}
+	// setting cluster defaults for the fetched cluster as well
+	currentCluster.setClusterDefaults(ctx)
+	// the fetched cluster shares the SSH connections of the cluster, they are closed together
+	currentCluster.setUpHostsSSH(c.knownHosts, c.BastionHost, c.sshPool)
 	return currentCluster, nil
 }
 
@@ -106,10 +140,10 @@ func saveStateToKubernetes(ctx context.Context, kubeClient *kubernetes.Clientset
 	}
 }
 
-func getStateFromKubernetes(ctx context.Context, kubeClient *kubernetes.Clientset, kubeConfigPath string) *Cluster {
+func getStateFromKubernetes(ctx context.Context, kubeClient *kubernetes.Clientset, kubeConfigPath string) *v3.RancherKubernetesEngineConfig {
 	log.Infof(ctx, "[state] Fetching cluster state from Kubernetes")
 	var cfgMap *v1.ConfigMap
-	var currentCluster Cluster
+	var rkeConfig v3.RancherKubernetesEngineConfig
 	var err error
 	timeout := make(chan bool, 1)
 	go func() {
@@ -127,28 +161,36 @@ func getStateFromKubernetes(ctx context.Context, kubeClient *kubernetes.Clientse
 	select {
 	case <-timeout:
 		clusterData := cfgMap.Data[StateConfigMapName]
-		err := yaml.Unmarshal([]byte(clusterData), &currentCluster)
+		err := yaml.Unmarshal([]byte(clusterData), &rkeConfig)
 		if err != nil {
 			return nil
 		}
-		return &currentCluster
+		return &rkeConfig
 	case <-time.After(time.Second * GetStateTimeout):
 		log.Infof(ctx, "Timed out waiting for kubernetes cluster to get state")
 		return nil
 	}
 }
 
-func GetK8sVersion(localConfigPath string) (string, error) {
+func GetK8sVersion(localConfigPath string, k8sDialer k8s.DialFunc) (string, error) {
+	serverVersion, err := getK8sServerVersion(localConfigPath, k8sDialer)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%#v", *serverVersion), nil
+}
+
+func getK8sServerVersion(localConfigPath string, k8sDialer k8s.DialFunc) (*version.Info, error) {
 	logrus.Debugf("[version] Using %s to connect to Kubernetes cluster..", localConfigPath)
-	k8sClient, err := k8s.NewClient(localConfigPath)
+	k8sClient, err := k8s.NewClient(localConfigPath, k8sDialer)
 	if err != nil {
-		return "", fmt.Errorf("Failed to create Kubernetes Client: %v", err)
+		return nil, fmt.Errorf("Failed to create Kubernetes Client: %v", err)
 	}
 	discoveryClient := k8sClient.DiscoveryClient
 	logrus.Debugf("[version] Getting Kubernetes server version..")
 	serverVersion, err := discoveryClient.ServerVersion()
 	if err != nil {
-		return "", fmt.Errorf("Failed to get Kubernetes server version: %v", err)
+		return nil, fmt.Errorf("Failed to get Kubernetes server version: %v", err)
 	}
-	return fmt.Sprintf("%#v", *serverVersion), nil
+	return serverVersion, nil
 }
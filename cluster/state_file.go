@@ -0,0 +1,224 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/pki"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+	"gopkg.in/yaml.v2"
+	"k8s.io/client-go/util/cert"
+)
+
+const StateFileExt = ".rkestate"
+
+// FullState is the content of the local state file, the desired state is the configuration being applied
+// and the current state is the last configuration applied successfully. The history is only written to the file by the local state store,
+// the other state stores keep it along with the cluster state. The host keys are the SSH host keys trusted on first use
+type FullState struct {
+	DesiredState State             `json:"desiredState,omitempty"`
+	CurrentState State             `json:"currentState,omitempty"`
+	History      []StateRevision   `json:"history,omitempty"`
+	HostKeys     map[string]string `json:"hostKeys,omitempty"`
+}
+
+type State struct {
+	RancherKubernetesEngineConfig *v3.RancherKubernetesEngineConfig `json:"rkeConfig,omitempty"`
+	CertificatesBundle            map[string]CertificateState       `json:"certificatesBundle,omitempty"`
+}
+
+// CertificateState holds the same certificate data as the certificates secrets
+type CertificateState struct {
+	Certificate   string `json:"certificate"`
+	Key           string `json:"key"`
+	Config        string `json:"config,omitempty"`
+	EnvName       string `json:"envName,omitempty"`
+	KeyEnvName    string `json:"keyEnvName,omitempty"`
+	ConfigEnvName string `json:"configEnvName,omitempty"`
+}
+
+func GetStateFile(configPath, configDir string) string {
+	return getClusterFileWithExt(configPath, configDir, StateFileExt)
+}
+
+// SaveDesiredState records the configuration and certificates being applied in the local state file
+func (c *Cluster) SaveDesiredState(ctx context.Context, rkeConfig *v3.RancherKubernetesEngineConfig) error {
+	localStore := &fileStateStore{path: c.StateFilePath}
+	return localStore.update(ctx, func(fullState *FullState) {
+		fullState.DesiredState = State{
+			RancherKubernetesEngineConfig: rkeConfig,
+			CertificatesBundle:            getCertificatesBundle(c.Certificates),
+		}
+	})
+}
+
+// saveCurrentState records the applied configuration and certificates in the local state file,
+// a nil configuration only updates the certificates
+func (c *Cluster) saveCurrentState(ctx context.Context, rkeConfig *v3.RancherKubernetesEngineConfig) error {
+	localStore := &fileStateStore{path: c.StateFilePath}
+	if rkeConfig != nil {
+		return localStore.SaveState(ctx, rkeConfig, c.Certificates)
+	}
+	return localStore.SaveCertificates(ctx, c.Certificates)
+}
+
+// getStateFromFile builds the current cluster from the current state of the local state file, it returns nil
+// if the file doesn't exist or no configuration was applied yet
+func (c *Cluster) getStateFromFile(ctx context.Context) (*Cluster, error) {
+	fullState, err := readStateFile(c.StateFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if fullState == nil || fullState.CurrentState.RancherKubernetesEngineConfig == nil {
+		return nil, nil
+	}
+	log.Infof(ctx, "[state] Found local state file [%s]", c.StateFilePath)
+	currentCluster := &Cluster{
+		RancherKubernetesEngineConfig: *fullState.CurrentState.RancherKubernetesEngineConfig,
+	}
+	if err := currentCluster.InvertIndexHosts(); err != nil {
+		return nil, fmt.Errorf("Failed to classify hosts from local state file: %v", err)
+	}
+	currentCluster.Certificates, err = getCertificatesFromBundle(fullState.CurrentState.CertificatesBundle)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read certificates from local state file [%s]: %v", c.StateFilePath, err)
+	}
+	currentCluster.DockerDialerFactory = c.DockerDialerFactory
+	currentCluster.LocalConnDialerFactory = c.LocalConnDialerFactory
+	currentCluster.setClusterDefaults(ctx)
+	// the fetched cluster shares the SSH connections of the cluster, they are closed together
+	currentCluster.setUpHostsSSH(c.knownHosts, c.BastionHost, c.sshPool)
+	return currentCluster, nil
+}
+
+// reconcileClusterStates prefers the local state file over the state saved in the state store, and warns if they diverge
+func reconcileClusterStates(ctx context.Context, stateFilePath string, fileCluster, storeCluster *Cluster) *Cluster {
+	if fileCluster == nil {
+		if storeCluster != nil {
+			log.Infof(ctx, "[state] Local state file [%s] not found, using the cluster state saved in the state store", stateFilePath)
+		}
+		return storeCluster
+	}
+	if storeCluster == nil {
+		log.Infof(ctx, "[state] Cluster state in the state store is not available, using local state file [%s]", stateFilePath)
+		return fileCluster
+	}
+	fileConfig, fileErr := yaml.Marshal(fileCluster.RancherKubernetesEngineConfig)
+	storeConfig, storeErr := yaml.Marshal(storeCluster.RancherKubernetesEngineConfig)
+	if fileErr != nil || storeErr != nil || !bytes.Equal(fileConfig, storeConfig) {
+		log.Warnf(ctx, "[state] Cluster configuration in local state file [%s] differs from the cluster state in the state store, using the local state file", stateFilePath)
+	}
+	if certificatesDiffer(fileCluster.Certificates, storeCluster.Certificates) {
+		log.Warnf(ctx, "[state] Certificates in local state file [%s] differ from the certificates in the state store, using the local state file", stateFilePath)
+	}
+	return fileCluster
+}
+
+// certificatesDiffer compares the certificates fetched from the state store, which can be a subset of the saved certificates
+func certificatesDiffer(fileCertificates, storeCertificates map[string]pki.CertificatePKI) bool {
+	fileBundle := getCertificatesBundle(fileCertificates)
+	for name, certificateState := range getCertificatesBundle(storeCertificates) {
+		fileCertificateState, ok := fileBundle[name]
+		if !ok || fileCertificateState.Certificate != certificateState.Certificate || fileCertificateState.Key != certificateState.Key {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cluster) removeStateFile(ctx context.Context) {
+	if err := os.Remove(c.StateFilePath); err != nil && !os.IsNotExist(err) {
+		log.Warnf(ctx, "Failed to remove local state file [%s]: %v", c.StateFilePath, err)
+		return
+	}
+	log.Infof(ctx, "Removed local state file [%s]", c.StateFilePath)
+}
+
+func readStateFile(path string) (*FullState, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Failed to read local state file [%s]: %v", path, err)
+	}
+	fullState := &FullState{}
+	if err := json.Unmarshal(content, fullState); err != nil {
+		return nil, fmt.Errorf("Failed to decode local state file [%s]: %v", path, err)
+	}
+	return fullState, nil
+}
+
+func writeStateFile(ctx context.Context, path string, fullState *FullState) error {
+	content, err := json.MarshalIndent(fullState, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to encode local state file: %v", err)
+	}
+	// the state file holds the certificates private keys
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		return fmt.Errorf("Failed to write local state file [%s]: %v", path, err)
+	}
+	log.Infof(ctx, "[state] Successfully saved cluster state to local state file [%s]", path)
+	return nil
+}
+
+func getCertificatesBundle(certificates map[string]pki.CertificatePKI) map[string]CertificateState {
+	if len(certificates) == 0 {
+		return nil
+	}
+	bundle := make(map[string]CertificateState)
+	for name, certificate := range certificates {
+		if certificate.Certificate == nil || certificate.Key == nil {
+			continue
+		}
+		certificateState := CertificateState{
+			Certificate: string(certificate.CertPEM()),
+			Key:         string(cert.EncodePrivateKeyPEM(certificate.Key)),
+			EnvName:     certificate.EnvName,
+			KeyEnvName:  certificate.KeyEnvName,
+		}
+		if len(certificate.Config) > 0 {
+			certificateState.Config = certificate.Config
+			certificateState.ConfigEnvName = certificate.ConfigEnvName
+		}
+		bundle[name] = certificateState
+	}
+	return bundle
+}
+
+func getCertificatesFromBundle(bundle map[string]CertificateState) (map[string]pki.CertificatePKI, error) {
+	if len(bundle) == 0 {
+		return nil, nil
+	}
+	certificates := make(map[string]pki.CertificatePKI)
+	for name, certificateState := range bundle {
+		certs, err := cert.ParseCertsPEM([]byte(certificateState.Certificate))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse certificate [%s]: %v", name, err)
+		}
+		key, err := cert.ParsePrivateKeyPEM([]byte(certificateState.Key))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse key of certificate [%s]: %v", name, err)
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("Key of certificate [%s] is not an RSA key", name)
+		}
+		certificates[name] = pki.CertificatePKI{
+			Certificate:   certs[0],
+			BundledCert:   pki.GetBundledCert(certs),
+			Key:           rsaKey,
+			Config:        certificateState.Config,
+			EnvName:       certificateState.EnvName,
+			KeyEnvName:    certificateState.KeyEnvName,
+			ConfigEnvName: certificateState.ConfigEnvName,
+		}
+	}
+	return certificates, nil
+}
@@ -0,0 +1,114 @@
+package cluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/rancher/rke/log"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+	"gopkg.in/yaml.v2"
+)
+
+type contextKey string
+
+const (
+	StateHistoryConfigMapName = "cluster-state-history"
+	DefaultStateHistoryLimit  = 10
+
+	rkeVersionContextKey contextKey = "rke-version"
+)
+
+// StateRevision is a configuration applied successfully by rke up
+type StateRevision struct {
+	Revision                      int                               `json:"revision"`
+	Timestamp                     time.Time                         `json:"timestamp"`
+	RKEVersion                    string                            `json:"rkeVersion,omitempty"`
+	ConfigHash                    string                            `json:"configHash"`
+	RancherKubernetesEngineConfig *v3.RancherKubernetesEngineConfig `json:"rkeConfig"`
+}
+
+// SetRKEVersion sets the rke version recorded in the state history by the clusters parsed with the returned context
+func SetRKEVersion(ctx context.Context, rkeVersion string) context.Context {
+	return context.WithValue(ctx, rkeVersionContextKey, rkeVersion)
+}
+
+func getContextRKEVersion(ctx context.Context) string {
+	rkeVersion, _ := ctx.Value(rkeVersionContextKey).(string)
+	return rkeVersion
+}
+
+// GetStateHistory returns the configurations applied to the cluster, the last one is the current configuration
+func (c *Cluster) GetStateHistory(ctx context.Context) ([]StateRevision, error) {
+	history, err := c.stateStore.GetHistory(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("[state] Failed to get cluster state history: %v", err)
+	}
+	return history, nil
+}
+
+// GetStateRevision returns the configuration applied by a revision of the state history
+func (c *Cluster) GetStateRevision(ctx context.Context, revision int) (*v3.RancherKubernetesEngineConfig, error) {
+	history, err := c.GetStateHistory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, stateRevision := range history {
+		if stateRevision.Revision == revision {
+			return stateRevision.RancherKubernetesEngineConfig, nil
+		}
+	}
+	return nil, fmt.Errorf("Revision [%d] is not in the cluster state history", revision)
+}
+
+// SaveStateRevision adds the applied configuration to the state history once rke up succeeded, unless it is the same
+// as the last revision
+func (c *Cluster) SaveStateRevision(ctx context.Context, rkeConfig *v3.RancherKubernetesEngineConfig) error {
+	history, err := c.stateStore.GetHistory(ctx)
+	if err != nil {
+		return err
+	}
+	configHash, err := getRKEConfigHash(rkeConfig)
+	if err != nil {
+		return err
+	}
+	revision := 1
+	if len(history) > 0 {
+		lastRevision := history[len(history)-1]
+		if lastRevision.ConfigHash == configHash {
+			return nil
+		}
+		revision = lastRevision.Revision + 1
+	}
+	history = append(history, StateRevision{
+		Revision:                      revision,
+		Timestamp:                     time.Now().UTC(),
+		RKEVersion:                    getContextRKEVersion(ctx),
+		ConfigHash:                    configHash,
+		RancherKubernetesEngineConfig: rkeConfig,
+	})
+	if limit := c.getStateHistoryLimit(); len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	if err := c.stateStore.SaveHistory(ctx, history); err != nil {
+		return err
+	}
+	log.Infof(ctx, "[state] Saved cluster configuration as revision [%d] of the state history", revision)
+	return nil
+}
+
+func (c *Cluster) getStateHistoryLimit() int {
+	if c.StateStore == nil || c.StateStore.HistoryLimit == 0 {
+		return DefaultStateHistoryLimit
+	}
+	return c.StateStore.HistoryLimit
+}
+
+func getRKEConfigHash(rkeConfig *v3.RancherKubernetesEngineConfig) (string, error) {
+	clusterConfig, err := yaml.Marshal(rkeConfig)
+	if err != nil {
+		return "", fmt.Errorf("Failed to encode cluster configuration: %v", err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(clusterConfig)), nil
+}
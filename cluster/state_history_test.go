@@ -0,0 +1,68 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+)
+
+func TestSaveStateRevision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rke-state-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kubeCluster := &Cluster{
+		RancherKubernetesEngineConfig: v3.RancherKubernetesEngineConfig{
+			StateStore: &v3.StateStoreConfig{HistoryLimit: 3},
+		},
+		stateStore: &fileStateStore{path: filepath.Join(dir, "cluster.rkestate")},
+	}
+
+	tests := []struct {
+		sshKeyPath string
+		revisions  []int
+	}{
+		{"key1", []int{1}},
+		{"key1", []int{1}},
+		{"key2", []int{1, 2}},
+		{"key1", []int{1, 2, 3}},
+		{"key3", []int{2, 3, 4}},
+		{"key3", []int{2, 3, 4}},
+		{"key4", []int{3, 4, 5}},
+	}
+	ctx := context.Background()
+	for i, test := range tests {
+		if err := kubeCluster.SaveStateRevision(ctx, &v3.RancherKubernetesEngineConfig{SSHKeyPath: test.sshKeyPath}); err != nil {
+			t.Fatalf("Failed to save state revision [%d]: %v", i, err)
+		}
+		history, err := kubeCluster.GetStateHistory(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		revisions := []int{}
+		for _, revision := range history {
+			revisions = append(revisions, revision.Revision)
+		}
+		assertEqual(t, fmt.Sprint(revisions), fmt.Sprint(test.revisions),
+			fmt.Sprintf("Failed to verify state history revisions after applying [%s] at step [%d]: %v", test.sshKeyPath, i, revisions))
+		assertEqual(t, history[len(history)-1].RancherKubernetesEngineConfig.SSHKeyPath, test.sshKeyPath,
+			fmt.Sprintf("Failed to verify last state revision at step [%d]", i))
+	}
+
+	for revision, sshKeyPath := range map[int]string{3: "key1", 4: "key3", 5: "key4"} {
+		rkeConfig, err := kubeCluster.GetStateRevision(ctx, revision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, rkeConfig.SSHKeyPath, sshKeyPath, fmt.Sprintf("Failed to get configuration of revision [%d]", revision))
+	}
+	if _, err := kubeCluster.GetStateRevision(ctx, 1); err == nil {
+		t.Fatal("Failed to reject revision trimmed from the state history")
+	}
+}
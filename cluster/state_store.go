@@ -0,0 +1,430 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/rancher/rke/backup"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/k8s"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/pki"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	KubernetesStateStore = "kubernetes"
+	LocalStateStore      = "local"
+	HTTPStateStore       = "http"
+	S3StateStore         = "s3"
+
+	HTTPStateStoreTimeout = 30
+)
+
+// StateStore saves the configuration, the certificates, the state history and the SSH host keys of the cluster, and loads them
+// back on the next run. SaveState saves the configuration and the certificates together. The getters return nil if nothing was saved yet
+type StateStore interface {
+	SaveState(ctx context.Context, rkeConfig *v3.RancherKubernetesEngineConfig, certificates map[string]pki.CertificatePKI) error
+	GetConfig(ctx context.Context) (*v3.RancherKubernetesEngineConfig, error)
+	SaveCertificates(ctx context.Context, certificates map[string]pki.CertificatePKI) error
+	GetCertificates(ctx context.Context, etcdHosts []*hosts.Host) (map[string]pki.CertificatePKI, error)
+	SaveHistory(ctx context.Context, history []StateRevision) error
+	GetHistory(ctx context.Context) ([]StateRevision, error)
+	SaveHostKeys(ctx context.Context, hostKeys map[string]string) error
+	GetHostKeys(ctx context.Context) (map[string]string, error)
+}
+
+// newStateStore returns the state store of the cluster state_store configuration
+func (c *Cluster) newStateStore() (StateStore, error) {
+	if c.RancherKubernetesEngineConfig.StateStore == nil {
+		return &kubernetesStateStore{kubeConfigPath: c.LocalKubeConfigPath, k8sDialer: c.K8sDialer}, nil
+	}
+	storeConfig := *c.RancherKubernetesEngineConfig.StateStore
+	switch storeConfig.Type {
+	case "", KubernetesStateStore:
+		return &kubernetesStateStore{kubeConfigPath: c.LocalKubeConfigPath, k8sDialer: c.K8sDialer}, nil
+	case LocalStateStore:
+		path := storeConfig.Path
+		if len(path) == 0 {
+			path = c.StateFilePath
+		}
+		return &fileStateStore{path: path}, nil
+	case HTTPStateStore:
+		httpClient := &http.Client{Timeout: time.Second * HTTPStateStoreTimeout}
+		return &objectStateStore{
+			name:     storeConfig.URL,
+			download: httpDownload(httpClient, storeConfig.URL, storeConfig.Headers),
+			upload:   httpUpload(httpClient, storeConfig.URL, storeConfig.Headers),
+		}, nil
+	case S3StateStore:
+		target, err := backup.NewTarget(*storeConfig.S3)
+		if err != nil {
+			return nil, err
+		}
+		return &objectStateStore{
+			name: storeConfig.S3.Bucket + "/" + storeConfig.Key,
+			// s3 doesn't support conditional writes, the object is overwritten
+			download: func(ctx context.Context) ([]byte, string, error) {
+				content, _, err := target.Download(ctx, storeConfig.Key)
+				if err != nil {
+					if backup.IsNotFound(err) {
+						return nil, "", nil
+					}
+					return nil, "", err
+				}
+				defer content.Close()
+				body, err := ioutil.ReadAll(content)
+				return body, "", err
+			},
+			upload: func(ctx context.Context, content []byte, etag string, exists bool) error {
+				return target.Upload(ctx, storeConfig.Key, bytes.NewReader(content), int64(len(content)))
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("State store type [%s] is not supported", storeConfig.Type)
+}
+
+// kubernetesStateStore keeps the configuration in the cluster-state ConfigMap and the certificates as secrets
+type kubernetesStateStore struct {
+	kubeConfigPath string
+	k8sDialer      k8s.DialFunc
+}
+
+func (s *kubernetesStateStore) SaveState(ctx context.Context, rkeConfig *v3.RancherKubernetesEngineConfig, certificates map[string]pki.CertificatePKI) error {
+	kubeClient, err := k8s.NewClient(s.kubeConfigPath, s.k8sDialer)
+	if err != nil {
+		return fmt.Errorf("Failed to re-initialize Kubernetes Client: %v", err)
+	}
+	if err := saveClusterCerts(ctx, kubeClient, certificates); err != nil {
+		return err
+	}
+	return saveStateToKubernetes(ctx, kubeClient, s.kubeConfigPath, rkeConfig)
+}
+
+func (s *kubernetesStateStore) GetConfig(ctx context.Context) (*v3.RancherKubernetesEngineConfig, error) {
+	if _, err := os.Stat(s.kubeConfigPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	kubeClient, err := k8s.NewClient(s.kubeConfigPath, s.k8sDialer)
+	if err != nil {
+		log.Warnf(ctx, "Failed to initiate new Kubernetes Client: %v", err)
+		return nil, nil
+	}
+	return getStateFromKubernetes(ctx, kubeClient, s.kubeConfigPath), nil
+}
+
+func (s *kubernetesStateStore) SaveCertificates(ctx context.Context, certificates map[string]pki.CertificatePKI) error {
+	kubeClient, err := k8s.NewClient(s.kubeConfigPath, s.k8sDialer)
+	if err != nil {
+		return fmt.Errorf("Failed to re-initialize Kubernetes Client: %v", err)
+	}
+	return saveClusterCerts(ctx, kubeClient, certificates)
+}
+
+func (s *kubernetesStateStore) GetCertificates(ctx context.Context, etcdHosts []*hosts.Host) (map[string]pki.CertificatePKI, error) {
+	kubeClient, err := k8s.NewClient(s.kubeConfigPath, s.k8sDialer)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initiate new Kubernetes Client: %v", err)
+	}
+	return getClusterCerts(ctx, kubeClient, etcdHosts)
+}
+
+func (s *kubernetesStateStore) SaveHistory(ctx context.Context, history []StateRevision) error {
+	kubeClient, err := k8s.NewClient(s.kubeConfigPath, s.k8sDialer)
+	if err != nil {
+		return fmt.Errorf("Failed to re-initialize Kubernetes Client: %v", err)
+	}
+	content, err := json.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("Failed to encode cluster state history: %v", err)
+	}
+	return k8s.UpdateConfigMap(kubeClient, content, StateHistoryConfigMapName)
+}
+
+func (s *kubernetesStateStore) GetHistory(ctx context.Context) ([]StateRevision, error) {
+	if _, err := os.Stat(s.kubeConfigPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	kubeClient, err := k8s.NewClient(s.kubeConfigPath, s.k8sDialer)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initiate new Kubernetes Client: %v", err)
+	}
+	cfgMap, err := k8s.GetConfigMap(kubeClient, StateHistoryConfigMapName)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	history := []StateRevision{}
+	if err := json.Unmarshal([]byte(cfgMap.Data[StateHistoryConfigMapName]), &history); err != nil {
+		return nil, fmt.Errorf("Failed to decode cluster state history: %v", err)
+	}
+	return history, nil
+}
+
+// The host keys are needed to reach the Kubernetes API through the SSH tunnels, so they're only kept in the local state file
+
+func (s *kubernetesStateStore) SaveHostKeys(ctx context.Context, hostKeys map[string]string) error {
+	return nil
+}
+
+func (s *kubernetesStateStore) GetHostKeys(ctx context.Context) (map[string]string, error) {
+	return nil, nil
+}
+
+// fileStateStore keeps the state in a file, with the same format as the local state file
+type fileStateStore struct {
+	path string
+}
+
+func (s *fileStateStore) SaveState(ctx context.Context, rkeConfig *v3.RancherKubernetesEngineConfig, certificates map[string]pki.CertificatePKI) error {
+	return s.update(ctx, func(fullState *FullState) {
+		fullState.CurrentState = State{
+			RancherKubernetesEngineConfig: rkeConfig,
+			CertificatesBundle:            getCertificatesBundle(certificates),
+		}
+		fullState.DesiredState = fullState.CurrentState
+	})
+}
+
+func (s *fileStateStore) GetConfig(ctx context.Context) (*v3.RancherKubernetesEngineConfig, error) {
+	fullState, err := readStateFile(s.path)
+	if err != nil || fullState == nil {
+		return nil, err
+	}
+	return fullState.CurrentState.RancherKubernetesEngineConfig, nil
+}
+
+func (s *fileStateStore) SaveCertificates(ctx context.Context, certificates map[string]pki.CertificatePKI) error {
+	return s.update(ctx, func(fullState *FullState) {
+		fullState.CurrentState.CertificatesBundle = getCertificatesBundle(certificates)
+		fullState.DesiredState.CertificatesBundle = fullState.CurrentState.CertificatesBundle
+	})
+}
+
+func (s *fileStateStore) GetCertificates(ctx context.Context, etcdHosts []*hosts.Host) (map[string]pki.CertificatePKI, error) {
+	fullState, err := readStateFile(s.path)
+	if err != nil || fullState == nil {
+		return nil, err
+	}
+	return getCertificatesFromBundle(fullState.CurrentState.CertificatesBundle)
+}
+
+func (s *fileStateStore) SaveHistory(ctx context.Context, history []StateRevision) error {
+	return s.update(ctx, func(fullState *FullState) {
+		fullState.History = history
+	})
+}
+
+func (s *fileStateStore) GetHistory(ctx context.Context) ([]StateRevision, error) {
+	fullState, err := readStateFile(s.path)
+	if err != nil || fullState == nil {
+		return nil, err
+	}
+	return fullState.History, nil
+}
+
+func (s *fileStateStore) SaveHostKeys(ctx context.Context, hostKeys map[string]string) error {
+	return s.update(ctx, func(fullState *FullState) {
+		fullState.HostKeys = hostKeys
+	})
+}
+
+func (s *fileStateStore) GetHostKeys(ctx context.Context) (map[string]string, error) {
+	fullState, err := readStateFile(s.path)
+	if err != nil || fullState == nil {
+		return nil, err
+	}
+	return fullState.HostKeys, nil
+}
+
+func (s *fileStateStore) update(ctx context.Context, updateState func(*FullState)) error {
+	fullState, err := readStateFile(s.path)
+	if err != nil {
+		return err
+	}
+	if fullState == nil {
+		fullState = &FullState{}
+	}
+	updateState(fullState)
+	return writeStateFile(ctx, s.path, fullState)
+}
+
+// objectStateStore keeps the configuration, the certificates and the state history in a single remote object.
+// download returns nil if the object doesn't exist, and the object version (ETag) if the backend supports it,
+// upload only overwrites the downloaded version of the object
+type objectStateStore struct {
+	name     string
+	download func(ctx context.Context) ([]byte, string, error)
+	upload   func(ctx context.Context, content []byte, etag string, exists bool) error
+}
+
+type objectState struct {
+	State
+	History  []StateRevision   `json:"history,omitempty"`
+	HostKeys map[string]string `json:"hostKeys,omitempty"`
+}
+
+func (s *objectStateStore) SaveState(ctx context.Context, rkeConfig *v3.RancherKubernetesEngineConfig, certificates map[string]pki.CertificatePKI) error {
+	return s.update(ctx, func(state *objectState) {
+		state.RancherKubernetesEngineConfig = rkeConfig
+		state.CertificatesBundle = getCertificatesBundle(certificates)
+	})
+}
+
+func (s *objectStateStore) GetConfig(ctx context.Context) (*v3.RancherKubernetesEngineConfig, error) {
+	state, _, err := s.getState(ctx)
+	if err != nil || state == nil {
+		return nil, err
+	}
+	return state.RancherKubernetesEngineConfig, nil
+}
+
+func (s *objectStateStore) SaveCertificates(ctx context.Context, certificates map[string]pki.CertificatePKI) error {
+	return s.update(ctx, func(state *objectState) {
+		state.CertificatesBundle = getCertificatesBundle(certificates)
+	})
+}
+
+func (s *objectStateStore) GetCertificates(ctx context.Context, etcdHosts []*hosts.Host) (map[string]pki.CertificatePKI, error) {
+	state, _, err := s.getState(ctx)
+	if err != nil || state == nil {
+		return nil, err
+	}
+	return getCertificatesFromBundle(state.CertificatesBundle)
+}
+
+func (s *objectStateStore) SaveHistory(ctx context.Context, history []StateRevision) error {
+	return s.update(ctx, func(state *objectState) {
+		state.History = history
+	})
+}
+
+func (s *objectStateStore) GetHistory(ctx context.Context) ([]StateRevision, error) {
+	state, _, err := s.getState(ctx)
+	if err != nil || state == nil {
+		return nil, err
+	}
+	return state.History, nil
+}
+
+func (s *objectStateStore) SaveHostKeys(ctx context.Context, hostKeys map[string]string) error {
+	return s.update(ctx, func(state *objectState) {
+		state.HostKeys = hostKeys
+	})
+}
+
+func (s *objectStateStore) GetHostKeys(ctx context.Context) (map[string]string, error) {
+	state, _, err := s.getState(ctx)
+	if err != nil || state == nil {
+		return nil, err
+	}
+	return state.HostKeys, nil
+}
+
+func (s *objectStateStore) getState(ctx context.Context) (*objectState, string, error) {
+	content, etag, err := s.download(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to get cluster state from [%s]: %v", s.name, err)
+	}
+	if content == nil {
+		return nil, "", nil
+	}
+	state := &objectState{}
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, "", fmt.Errorf("Failed to decode cluster state from [%s]: %v", s.name, err)
+	}
+	return state, etag, nil
+}
+
+func (s *objectStateStore) update(ctx context.Context, updateState func(*objectState)) error {
+	state, etag, err := s.getState(ctx)
+	if err != nil {
+		return err
+	}
+	exists := state != nil
+	if !exists {
+		state = &objectState{}
+	}
+	updateState(state)
+	content, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("Failed to encode cluster state: %v", err)
+	}
+	if err := s.upload(ctx, content, etag, exists); err != nil {
+		return fmt.Errorf("Failed to save cluster state to [%s]: %v", s.name, err)
+	}
+	log.Infof(ctx, "[state] Successfully saved cluster state to [%s]", s.name)
+	return nil
+}
+
+func httpDownload(httpClient *http.Client, url string, headers map[string]string) func(ctx context.Context) ([]byte, string, error) {
+	return func(ctx context.Context) ([]byte, string, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		setHTTPHeaders(req, headers)
+		resp, err := httpClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, "", nil
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, "", err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, "", fmt.Errorf("response code: [%d], response body: %s", resp.StatusCode, body)
+		}
+		return body, resp.Header.Get("ETag"), nil
+	}
+}
+
+// httpUpload only overwrites the version of the state that was downloaded, with If-Match, or creates it
+// if it didn't exist, with If-None-Match, so that concurrent runs don't overwrite each other
+func httpUpload(httpClient *http.Client, url string, headers map[string]string) func(ctx context.Context, content []byte, etag string, exists bool) error {
+	return func(ctx context.Context, content []byte, etag string, exists bool) error {
+		req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(content))
+		if err != nil {
+			return err
+		}
+		setHTTPHeaders(req, headers)
+		req.Header.Set("Content-Type", "application/json")
+		if !exists {
+			req.Header.Set("If-None-Match", "*")
+		} else if len(etag) > 0 {
+			req.Header.Set("If-Match", etag)
+		}
+		resp, err := httpClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusPreconditionFailed {
+			return fmt.Errorf("the cluster state was changed by another run, run the command again")
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			body, _ := ioutil.ReadAll(resp.Body)
+			return fmt.Errorf("response code: [%d], response body: %s", resp.StatusCode, body)
+		}
+		return nil
+	}
+}
+
+func setHTTPHeaders(req *http.Request, headers map[string]string) {
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+}
@@ -0,0 +1,214 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rancher/rke/pki"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+	"k8s.io/client-go/util/cert"
+)
+
+const (
+	TestStateSSHKeyPath    = "~/.ssh/test"
+	TestStateStoreToken    = "Bearer test-token"
+	TestStateStoreConflict = "changed by another run"
+	TestStateHostAddress   = "1.1.1.1:22"
+	TestStateHostKey       = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHRlc3Q="
+)
+
+// memoryObject is an in-memory remote object, its version is incremented on each upload
+type memoryObject struct {
+	content []byte
+	version int
+	uploads int
+}
+
+func (o *memoryObject) download(ctx context.Context) ([]byte, string, error) {
+	if o.content == nil {
+		return nil, "", nil
+	}
+	return o.content, fmt.Sprintf("%d", o.version), nil
+}
+
+func (o *memoryObject) upload(ctx context.Context, content []byte, etag string, exists bool) error {
+	if exists != (o.content != nil) || (exists && etag != fmt.Sprintf("%d", o.version)) {
+		return fmt.Errorf("precondition failed")
+	}
+	o.content = content
+	o.version++
+	o.uploads++
+	return nil
+}
+
+func TestStateStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rke-state-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certificates := getTestStateCertificates(t)
+	object := &memoryObject{}
+
+	tests := []struct {
+		name  string
+		store StateStore
+	}{
+		{"file", &fileStateStore{path: filepath.Join(dir, "cluster.rkestate")}},
+		{"object", &objectStateStore{name: "memory", download: object.download, upload: object.upload}},
+	}
+	for _, test := range tests {
+		ctx := context.Background()
+		rkeConfig, err := test.store.GetConfig(ctx)
+		assertEqual(t, err == nil && rkeConfig == nil, true, fmt.Sprintf("Failed to get empty config of [%s] store: %v", test.name, err))
+		savedCertificates, err := test.store.GetCertificates(ctx, nil)
+		assertEqual(t, err == nil && savedCertificates == nil, true, fmt.Sprintf("Failed to get empty certificates of [%s] store: %v", test.name, err))
+		history, err := test.store.GetHistory(ctx)
+		assertEqual(t, err == nil && history == nil, true, fmt.Sprintf("Failed to get empty history of [%s] store: %v", test.name, err))
+		hostKeys, err := test.store.GetHostKeys(ctx)
+		assertEqual(t, err == nil && hostKeys == nil, true, fmt.Sprintf("Failed to get empty host keys of [%s] store: %v", test.name, err))
+
+		if err := test.store.SaveState(ctx, &v3.RancherKubernetesEngineConfig{SSHKeyPath: TestStateSSHKeyPath}, certificates); err != nil {
+			t.Fatalf("Failed to save state of [%s] store: %v", test.name, err)
+		}
+		if err := test.store.SaveHistory(ctx, []StateRevision{{Revision: 1, ConfigHash: "hash"}}); err != nil {
+			t.Fatalf("Failed to save history of [%s] store: %v", test.name, err)
+		}
+
+		rkeConfig, err = test.store.GetConfig(ctx)
+		if err != nil || rkeConfig == nil {
+			t.Fatalf("Failed to get config of [%s] store: %v", test.name, err)
+		}
+		assertEqual(t, rkeConfig.SSHKeyPath, TestStateSSHKeyPath, fmt.Sprintf("Failed to verify config of [%s] store", test.name))
+		savedCertificates, err = test.store.GetCertificates(ctx, nil)
+		if err != nil {
+			t.Fatalf("Failed to get certificates of [%s] store: %v", test.name, err)
+		}
+		assertEqual(t, len(savedCertificates), len(certificates), fmt.Sprintf("Failed to verify certificates of [%s] store", test.name))
+		assertEqual(t, savedCertificates[pki.CACertName].Certificate.SerialNumber.String(), certificates[pki.CACertName].Certificate.SerialNumber.String(),
+			fmt.Sprintf("Failed to verify CA certificate of [%s] store", test.name))
+		assertEqual(t, savedCertificates[pki.CACertName].Key.N.String(), certificates[pki.CACertName].Key.N.String(),
+			fmt.Sprintf("Failed to verify CA key of [%s] store", test.name))
+		history, err = test.store.GetHistory(ctx)
+		if err != nil {
+			t.Fatalf("Failed to get history of [%s] store: %v", test.name, err)
+		}
+		assertEqual(t, len(history), 1, fmt.Sprintf("Failed to verify history of [%s] store", test.name))
+
+		// saving the certificates keeps the configuration
+		if err := test.store.SaveCertificates(ctx, certificates); err != nil {
+			t.Fatalf("Failed to save certificates of [%s] store: %v", test.name, err)
+		}
+		rkeConfig, err = test.store.GetConfig(ctx)
+		assertEqual(t, err == nil && rkeConfig != nil && rkeConfig.SSHKeyPath == TestStateSSHKeyPath, true,
+			fmt.Sprintf("Failed to keep config of [%s] store after saving certificates: %v", test.name, err))
+
+		if err := test.store.SaveHostKeys(ctx, map[string]string{TestStateHostAddress: TestStateHostKey}); err != nil {
+			t.Fatalf("Failed to save host keys of [%s] store: %v", test.name, err)
+		}
+		hostKeys, err = test.store.GetHostKeys(ctx)
+		if err != nil {
+			t.Fatalf("Failed to get host keys of [%s] store: %v", test.name, err)
+		}
+		assertEqual(t, hostKeys[TestStateHostAddress], TestStateHostKey, fmt.Sprintf("Failed to verify host keys of [%s] store", test.name))
+		history, err = test.store.GetHistory(ctx)
+		assertEqual(t, err == nil && len(history) == 1, true, fmt.Sprintf("Failed to keep history of [%s] store after saving host keys: %v", test.name, err))
+	}
+	assertEqual(t, object.uploads, 4, "Failed to save each change of the object store state in one upload")
+}
+
+func TestObjectStateStoreConflict(t *testing.T) {
+	object := &memoryObject{}
+	store := &objectStateStore{
+		name:     "memory",
+		download: object.download,
+		upload: func(ctx context.Context, content []byte, etag string, exists bool) error {
+			// another run saves the state between the download and the upload
+			object.version++
+			return object.upload(ctx, content, etag, exists)
+		},
+	}
+	object.content = []byte("{}")
+	if err := store.SaveHistory(context.Background(), []StateRevision{{Revision: 1}}); err == nil {
+		t.Fatal("Failed to reject saving a state changed concurrently")
+	}
+}
+
+func TestHTTPStateStore(t *testing.T) {
+	var content []byte
+	etag := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != TestStateStoreToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		currentETag := fmt.Sprintf(`"%d"`, etag)
+		switch req.Method {
+		case http.MethodGet:
+			if content == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("ETag", currentETag)
+			w.Write(content)
+		case http.MethodPut:
+			if (content == nil && req.Header.Get("If-None-Match") != "*") ||
+				(content != nil && req.Header.Get("If-Match") != currentETag) {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			content, _ = ioutil.ReadAll(req.Body)
+			etag++
+		}
+	}))
+	defer server.Close()
+
+	headers := map[string]string{"Authorization": TestStateStoreToken}
+	httpClient := &http.Client{Timeout: time.Second * HTTPStateStoreTimeout}
+	store := &objectStateStore{
+		name:     server.URL,
+		download: httpDownload(httpClient, server.URL, headers),
+		upload:   httpUpload(httpClient, server.URL, headers),
+	}
+	ctx := context.Background()
+	if err := store.SaveState(ctx, &v3.RancherKubernetesEngineConfig{SSHKeyPath: TestStateSSHKeyPath}, nil); err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+	if err := store.SaveHistory(ctx, []StateRevision{{Revision: 1}}); err != nil {
+		t.Fatalf("Failed to update state: %v", err)
+	}
+	rkeConfig, err := store.GetConfig(ctx)
+	assertEqual(t, err == nil && rkeConfig != nil && rkeConfig.SSHKeyPath == TestStateSSHKeyPath, true, fmt.Sprintf("Failed to get state: %v", err))
+
+	staleUpload := httpUpload(httpClient, server.URL, headers)
+	err = staleUpload(ctx, []byte("{}"), `"0"`, true)
+	assertEqual(t, err != nil && strings.Contains(err.Error(), TestStateStoreConflict), true, fmt.Sprintf("Failed to reject stale state: %v", err))
+	err = staleUpload(ctx, []byte("{}"), "", false)
+	assertEqual(t, err != nil && strings.Contains(err.Error(), TestStateStoreConflict), true, fmt.Sprintf("Failed to reject creating existing state: %v", err))
+
+	if _, _, err := httpDownload(httpClient, server.URL, nil)(ctx); err == nil {
+		t.Fatal("Failed to return the error of an unauthorized request")
+	}
+}
+
+func getTestStateCertificates(t *testing.T) map[string]pki.CertificatePKI {
+	key, err := cert.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := cert.NewSelfSignedCACert(cert.Config{CommonName: pki.CACertName}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]pki.CertificatePKI{
+		pki.CACertName: pki.ToCertObject(pki.CACertName, "", "", caCert, key),
+	}
+}
@@ -0,0 +1,111 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rancher/rke/k8s"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/pki"
+	"github.com/rancher/rke/services"
+	"k8s.io/client-go/util/cert"
+)
+
+// Status is the health of the RKE containers, etcd members and Kubernetes nodes of the cluster
+type Status struct {
+	Containers  []services.ContainerStatus  `json:"containers"`
+	EtcdMembers []services.EtcdMemberStatus `json:"etcdMembers"`
+	Nodes       []NodeStatus                `json:"nodes"`
+	Errors      []string                    `json:"errors,omitempty"`
+}
+
+type NodeStatus struct {
+	Host       string `json:"host"`
+	NodeName   string `json:"nodeName"`
+	Registered bool   `json:"registered"`
+	Ready      bool   `json:"ready"`
+}
+
+// GetClusterStatus inspects every host of the cluster, it doesn't change the hosts or the cluster.
+// Failing to reach etcd or the Kubernetes API is reported in the status errors
+func GetClusterStatus(ctx context.Context, kubeCluster *Cluster) (*Status, error) {
+	status := &Status{}
+	now := time.Now()
+	// every host is tunneled on its own so that one unreachable host doesn't hide the others
+	for _, host := range kubeCluster.getUniqueHostList() {
+		log.Infof(ctx, "[status] Checking containers on host [%s]", host.Address)
+		if err := host.TunnelUp(ctx, kubeCluster.DockerDialerFactory); err != nil {
+			status.Containers = append(status.Containers, services.GetUnreachableHostContainersStatus(host)...)
+			status.Errors = append(status.Errors, fmt.Sprintf("Host [%s] is not reachable: %v", host.Address, err))
+			continue
+		}
+		containers, err := services.GetHostContainersStatus(ctx, host, kubeCluster.LocalConnDialerFactory, now)
+		if err != nil {
+			status.Containers = append(status.Containers, services.GetUnreachableHostContainersStatus(host)...)
+			status.Errors = append(status.Errors, fmt.Sprintf("Failed to inspect containers on host [%s]: %v", host.Address, err))
+			continue
+		}
+		status.Containers = append(status.Containers, containers...)
+	}
+	if err := kubeCluster.SaveHostKeys(ctx); err != nil {
+		log.Warnf(ctx, "[status] %v", err)
+	}
+
+	k8sReachable := false
+	if _, err := GetK8sVersion(kubeCluster.LocalKubeConfigPath, kubeCluster.K8sDialer); err != nil {
+		status.Errors = append(status.Errors, fmt.Sprintf("Kubernetes API is not reachable: %v", err))
+	} else {
+		k8sReachable = true
+	}
+
+	if kubeCluster.Authentication.Strategy == X509AuthenticationProvider {
+		log.Infof(ctx, "[status] Checking etcd members health")
+		certificates, err := kubeCluster.GetClusterCertificates(ctx)
+		if err != nil {
+			status.Errors = append(status.Errors, fmt.Sprintf("Failed to get etcd client certificate: %v", err))
+		} else {
+			clientCert := cert.EncodeCertPEM(certificates[pki.KubeNodeCertName].Certificate)
+			clientKey := cert.EncodePrivateKeyPEM(certificates[pki.KubeNodeCertName].Key)
+			status.EtcdMembers = services.GetEtcdMembersStatus(ctx, kubeCluster.EtcdHosts, kubeCluster.LocalConnDialerFactory, clientCert, clientKey)
+		}
+	}
+
+	if k8sReachable {
+		log.Infof(ctx, "[status] Checking Kubernetes nodes status")
+		nodes, err := kubeCluster.getNodesStatus()
+		if err != nil {
+			status.Errors = append(status.Errors, err.Error())
+		} else {
+			status.Nodes = nodes
+		}
+	}
+	return status, nil
+}
+
+func (c *Cluster) getNodesStatus() ([]NodeStatus, error) {
+	kubeClient, err := k8s.NewClient(c.LocalKubeConfigPath, c.K8sDialer)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initiate new Kubernetes Client: %v", err)
+	}
+	nodeList, err := k8s.GetNodeList(kubeClient)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list Kubernetes nodes: %v", err)
+	}
+	nodes := []NodeStatus{}
+	for _, host := range c.getUniqueHostList() {
+		nodeStatus := NodeStatus{
+			Host:     host.Address,
+			NodeName: host.HostnameOverride,
+		}
+		for _, node := range nodeList.Items {
+			if node.Name == host.HostnameOverride {
+				nodeStatus.Registered = true
+				nodeStatus.Ready = k8s.IsNodeReady(node)
+				break
+			}
+		}
+		nodes = append(nodes, nodeStatus)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,239 @@
+package cluster
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/rke/docker"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/k8s"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/pki"
+	"github.com/rancher/rke/services"
+)
+
+const (
+	SupportBundleDir = "rke-support-bundle"
+
+	supportBundleErrorsFile = "errors.txt"
+)
+
+// supportBundleHostDirs are read through the kubelet container, which mounts them from the host
+var supportBundleHostDirs = []string{"/etc/kubernetes", "/etc/cni"}
+
+type supportBundle struct {
+	tarWriter *tar.Writer
+	now       time.Time
+	errors    []string
+}
+
+// WriteSupportBundle collects the diagnostics of every host and of the Kubernetes cluster and writes them to out
+// as a tar.gz archive. Failing to collect part of the diagnostics is reported in the archive errors file
+func WriteSupportBundle(ctx context.Context, kubeCluster *Cluster, out io.Writer) error {
+	gzipWriter := gzip.NewWriter(out)
+	bundle := &supportBundle{
+		tarWriter: tar.NewWriter(gzipWriter),
+		now:       time.Now(),
+	}
+	hostList := kubeCluster.getUniqueHostList()
+	sort.Slice(hostList, func(i, j int) bool {
+		return hostList[i].Address < hostList[j].Address
+	})
+	for _, host := range hostList {
+		log.Infof(ctx, "[support-bundle] Collecting diagnostics from host [%s]", host.Address)
+		if err := host.TunnelUp(ctx, kubeCluster.DockerDialerFactory); err != nil {
+			bundle.addError(fmt.Errorf("Failed to set up SSH tunneling for host [%s]: %v", host.Address, err))
+			continue
+		}
+		if err := bundle.addHost(ctx, host); err != nil {
+			return err
+		}
+	}
+	log.Infof(ctx, "[support-bundle] Collecting Kubernetes nodes, pods and events")
+	if err := bundle.addKubernetesResources(kubeCluster.LocalKubeConfigPath, kubeCluster.K8sDialer); err != nil {
+		return err
+	}
+	if len(bundle.errors) > 0 {
+		if err := bundle.addFile(supportBundleErrorsFile, []byte(strings.Join(bundle.errors, "\n")+"\n")); err != nil {
+			return err
+		}
+	}
+	if err := bundle.tarWriter.Close(); err != nil {
+		return fmt.Errorf("Failed to write support bundle: %v", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return fmt.Errorf("Failed to write support bundle: %v", err)
+	}
+	return nil
+}
+
+// addHost only returns archive write errors, collection errors are added to the bundle errors
+func (b *supportBundle) addHost(ctx context.Context, host *hosts.Host) error {
+	hostDir := path.Join("hosts", host.Address)
+	info, err := host.DClient.Info(ctx)
+	if err != nil {
+		b.addError(fmt.Errorf("Failed to get docker info on host [%s]: %v", host.Address, err))
+	} else if err := b.addJSON(path.Join(hostDir, "docker-info.json"), info); err != nil {
+		return err
+	}
+
+	containerNames := append([]string{}, services.ServiceContainerNames...)
+	containerNames = append(containerNames, services.SidekickContainerName)
+	kubeletExists := false
+	for _, containerName := range containerNames {
+		exists, err := docker.IsContainerRunning(ctx, host.DClient, host.Address, containerName, true)
+		if err != nil {
+			b.addError(err)
+			return nil
+		}
+		if !exists {
+			continue
+		}
+		if containerName == services.KubeletContainerName {
+			kubeletExists = true
+		}
+		if err := b.addContainer(ctx, host, path.Join(hostDir, "containers", containerName), containerName); err != nil {
+			return err
+		}
+	}
+
+	if !kubeletExists {
+		b.addError(fmt.Errorf("Failed to read %v on host [%s]: container [%s] not found", supportBundleHostDirs, host.Address, services.KubeletContainerName))
+		return nil
+	}
+	for _, dirPath := range supportBundleHostDirs {
+		if err := b.addContainerDir(ctx, host, hostDir, services.KubeletContainerName, dirPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *supportBundle) addContainer(ctx context.Context, host *hosts.Host, containerDir, containerName string) error {
+	containerInspect, err := docker.InspectContainer(ctx, host.DClient, host.Address, containerName)
+	if err != nil {
+		b.addError(err)
+		return nil
+	}
+	if err := b.addJSON(path.Join(containerDir, "inspect.json"), containerInspect); err != nil {
+		return err
+	}
+	logs, err := docker.ReadContainerLogs(ctx, host.DClient, containerName)
+	if err != nil {
+		b.addError(fmt.Errorf("Failed to read logs of container [%s] on host [%s]: %v", containerName, host.Address, err))
+		return nil
+	}
+	defer logs.Close()
+	logBuffer := &bytes.Buffer{}
+	if containerInspect.Config.Tty {
+		_, err = io.Copy(logBuffer, logs)
+	} else {
+		err = docker.DemuxContainerLogs(logBuffer, logs)
+	}
+	if err != nil {
+		b.addError(fmt.Errorf("Failed to read logs of container [%s] on host [%s]: %v", containerName, host.Address, err))
+	}
+	return b.addFile(path.Join(containerDir, "logs.txt"), logBuffer.Bytes())
+}
+
+// addContainerDir adds the regular files of the directory, with their private keys redacted
+func (b *supportBundle) addContainerDir(ctx context.Context, host *hosts.Host, hostDir, containerName, dirPath string) error {
+	reader, err := docker.CopyDirFromContainer(ctx, host.DClient, host.Address, containerName, dirPath)
+	if err != nil {
+		b.addError(err)
+		return nil
+	}
+	defer reader.Close()
+	// entries are relative to the directory parent, for example kubernetes/ssl/kube-ca.pem
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			b.addError(fmt.Errorf("Failed to read [%s] on host [%s]: %v", dirPath, host.Address, err))
+			return nil
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			b.addError(fmt.Errorf("Failed to read [%s] on host [%s]: %v", header.Name, host.Address, err))
+			return nil
+		}
+		if err := b.addFile(path.Join(hostDir, path.Dir(dirPath), header.Name), pki.RedactPrivateKeys(content)); err != nil {
+			return err
+		}
+	}
+}
+
+func (b *supportBundle) addKubernetesResources(localConfigPath string, k8sDialer k8s.DialFunc) error {
+	if _, err := GetK8sVersion(localConfigPath, k8sDialer); err != nil {
+		b.addError(fmt.Errorf("Kubernetes API is not reachable: %v", err))
+		return nil
+	}
+	kubeClient, err := k8s.NewClient(localConfigPath, k8sDialer)
+	if err != nil {
+		b.addError(fmt.Errorf("Failed to initiate new Kubernetes Client: %v", err))
+		return nil
+	}
+	nodes, err := k8s.GetNodeList(kubeClient)
+	if err != nil {
+		b.addError(fmt.Errorf("Failed to list Kubernetes nodes: %v", err))
+	} else if err := b.addJSON("cluster/nodes.json", nodes); err != nil {
+		return err
+	}
+	pods, err := k8s.GetPodList(kubeClient)
+	if err != nil {
+		b.addError(fmt.Errorf("Failed to list Kubernetes pods: %v", err))
+	} else if err := b.addJSON("cluster/pods.json", pods); err != nil {
+		return err
+	}
+	events, err := k8s.GetEventList(kubeClient)
+	if err != nil {
+		b.addError(fmt.Errorf("Failed to list Kubernetes events: %v", err))
+	} else if err := b.addJSON("cluster/events.json", events); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (b *supportBundle) addJSON(name string, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to encode [%s]: %v", name, err)
+	}
+	return b.addFile(name, content)
+}
+
+func (b *supportBundle) addFile(name string, content []byte) error {
+	header := &tar.Header{
+		Name:    path.Join(SupportBundleDir, name),
+		Mode:    0600,
+		Size:    int64(len(content)),
+		ModTime: b.now,
+	}
+	if err := b.tarWriter.WriteHeader(header); err != nil {
+		return fmt.Errorf("Failed to write [%s] to support bundle: %v", name, err)
+	}
+	if _, err := b.tarWriter.Write(content); err != nil {
+		return fmt.Errorf("Failed to write [%s] to support bundle: %v", name, err)
+	}
+	return nil
+}
+
+func (b *supportBundle) addError(err error) {
+	b.errors = append(b.errors, err.Error())
+}
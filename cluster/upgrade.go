@@ -0,0 +1,245 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	ref "github.com/docker/distribution/reference"
+	"github.com/rancher/rke/k8s"
+	"github.com/rancher/rke/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	UpgradeStateConfigMapName = "cluster-upgrade-state"
+
+	upgradeStepEtcd              = "etcd"
+	upgradeStepControlHostPrefix = "controlplane/"
+	upgradeStepWorkerPlane       = "workerplane"
+)
+
+var k8sVersionRegexp = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)`)
+
+// UpgradeState records the progress of a Kubernetes version upgrade, so that an interrupted upgrade can be resumed
+type UpgradeState struct {
+	FromVersion    string   `json:"fromVersion"`
+	ToVersion      string   `json:"toVersion"`
+	ConfigHash     string   `json:"configHash"`
+	CompletedSteps []string `json:"completedSteps"`
+}
+
+type kubernetesUpgrade struct {
+	state      UpgradeState
+	kubeClient *kubernetes.Clientset
+}
+
+type k8sVersion struct {
+	major, minor, patch int
+}
+
+// SetUpKubernetesUpgrade compares the running Kubernetes version with the target version and rejects downgrades and
+// upgrades that skip a minor version. An allowed upgrade, or an interrupted one, is then deployed step by step
+func (c *Cluster) SetUpKubernetesUpgrade(ctx context.Context, currentCluster *Cluster) error {
+	if currentCluster == nil {
+		return nil
+	}
+	targetVersion, err := getImageK8sVersion(c.SystemImages.Kubernetes)
+	if err != nil {
+		log.Warnf(ctx, "[upgrade] Skipping Kubernetes version check: %v", err)
+		return nil
+	}
+	serverVersion, err := getK8sServerVersion(c.LocalKubeConfigPath, c.K8sDialer)
+	if err != nil {
+		// the current cluster can come from the local state file while the Kubernetes API is down
+		if c.SkipVersionCheck {
+			log.Warnf(ctx, "[upgrade] Skipping Kubernetes version check, Kubernetes API is not reachable: %v", err)
+			return nil
+		}
+		return fmt.Errorf("Failed to get the running Kubernetes version, the version skew and any interrupted upgrade can't be checked: %v. "+
+			"Use --skip-version-check to deploy the cluster without checking them", err)
+	}
+	kubeClient, err := k8s.NewClient(c.LocalKubeConfigPath, c.K8sDialer)
+	if err != nil {
+		return fmt.Errorf("Failed to initialize new kubernetes client: %v", err)
+	}
+	upgradeState, err := getUpgradeState(kubeClient)
+	if err != nil {
+		return err
+	}
+	if upgradeState != nil && upgradeState.ToVersion != targetVersion.String() {
+		if len(upgradeState.CompletedSteps) > 0 {
+			return fmt.Errorf("The Kubernetes upgrade from [%s] to [%s] was interrupted, set the Kubernetes version back to [%s] and run rke up to resume it",
+				upgradeState.FromVersion, upgradeState.ToVersion, upgradeState.ToVersion)
+		}
+		// nothing was upgraded yet, the upgrade is planned again for the new target version
+		upgradeState = nil
+	}
+	if upgradeState == nil {
+		runningVersion, err := parseK8sVersion(serverVersion.GitVersion)
+		if err != nil {
+			return err
+		}
+		if err := validateK8sVersionSkew(runningVersion, targetVersion); err != nil {
+			return err
+		}
+		if runningVersion == targetVersion {
+			return nil
+		}
+		log.Infof(ctx, "[upgrade] Upgrading Kubernetes from [%s] to [%s]", runningVersion, targetVersion)
+		upgradeState = &UpgradeState{
+			FromVersion: runningVersion.String(),
+			ToVersion:   targetVersion.String(),
+		}
+	} else {
+		log.Infof(ctx, "[upgrade] Resuming Kubernetes upgrade from [%s] to [%s]", upgradeState.FromVersion, upgradeState.ToVersion)
+	}
+	configHash, err := getConfigHash(c)
+	if err != nil {
+		return err
+	}
+	if upgradeState.ConfigHash != configHash {
+		if len(upgradeState.CompletedSteps) > 0 {
+			log.Infof(ctx, "[upgrade] Cluster configuration changed since the upgrade was interrupted, running all the upgrade steps again")
+		}
+		upgradeState.ConfigHash = configHash
+		upgradeState.CompletedSteps = nil
+	}
+	c.upgrade = &kubernetesUpgrade{
+		state:      *upgradeState,
+		kubeClient: kubeClient,
+	}
+	return c.upgrade.save()
+}
+
+// runUpgradeStep deploys a step of the Kubernetes upgrade and records it, a step completed by an interrupted upgrade is skipped.
+// Without an upgrade in progress the step is only deployed
+func (c *Cluster) runUpgradeStep(ctx context.Context, step string, deploy func() error) error {
+	if c.upgrade == nil {
+		return deploy()
+	}
+	if c.upgrade.isStepCompleted(step) {
+		log.Infof(ctx, "[upgrade] Skipping completed upgrade step [%s]", step)
+		return nil
+	}
+	if err := deploy(); err != nil {
+		return err
+	}
+	c.upgrade.state.CompletedSteps = append(c.upgrade.state.CompletedSteps, step)
+	return c.upgrade.save()
+}
+
+// FinishKubernetesUpgrade deletes the upgrade state once the worker plane is deployed, including when the worker plane
+// phase was completed by a previous run
+func (c *Cluster) FinishKubernetesUpgrade(ctx context.Context) error {
+	if c.upgrade == nil {
+		return nil
+	}
+	if err := c.upgrade.finish(ctx); err != nil {
+		return err
+	}
+	c.upgrade = nil
+	return nil
+}
+
+func (u *kubernetesUpgrade) isStepCompleted(step string) bool {
+	for _, completedStep := range u.state.CompletedSteps {
+		if completedStep == step {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *kubernetesUpgrade) save() error {
+	upgradeState, err := json.Marshal(u.state)
+	if err != nil {
+		return fmt.Errorf("Failed to encode Kubernetes upgrade state: %v", err)
+	}
+	if err := k8s.UpdateConfigMap(u.kubeClient, upgradeState, UpgradeStateConfigMapName); err != nil {
+		return fmt.Errorf("Failed to save Kubernetes upgrade state: %v", err)
+	}
+	return nil
+}
+
+func (u *kubernetesUpgrade) finish(ctx context.Context) error {
+	if err := k8s.DeleteConfigMap(u.kubeClient, UpgradeStateConfigMapName); err != nil {
+		return fmt.Errorf("Failed to delete Kubernetes upgrade state: %v", err)
+	}
+	log.Infof(ctx, "[upgrade] Finished upgrading Kubernetes from [%s] to [%s]", u.state.FromVersion, u.state.ToVersion)
+	return nil
+}
+
+func getUpgradeState(kubeClient *kubernetes.Clientset) (*UpgradeState, error) {
+	cfgMap, err := k8s.GetConfigMap(kubeClient, UpgradeStateConfigMapName)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Failed to get Kubernetes upgrade state: %v", err)
+	}
+	upgradeState := &UpgradeState{}
+	if err := json.Unmarshal([]byte(cfgMap.Data[UpgradeStateConfigMapName]), upgradeState); err != nil {
+		return nil, fmt.Errorf("Failed to decode Kubernetes upgrade state: %v", err)
+	}
+	return upgradeState, nil
+}
+
+func getConfigHash(c *Cluster) (string, error) {
+	return getRKEConfigHash(&c.RancherKubernetesEngineConfig)
+}
+
+func validateK8sVersionSkew(runningVersion, targetVersion k8sVersion) error {
+	if targetVersion.less(runningVersion) {
+		return fmt.Errorf("Downgrading Kubernetes from [%s] to [%s] isn't supported", runningVersion, targetVersion)
+	}
+	if targetVersion.major != runningVersion.major {
+		return fmt.Errorf("Upgrading Kubernetes from [%s] to [%s] isn't supported", runningVersion, targetVersion)
+	}
+	if targetVersion.minor > runningVersion.minor+1 {
+		return fmt.Errorf("Upgrading Kubernetes from [%s] to [%s] skips a minor version, upgrade to v%d.%d first",
+			runningVersion, targetVersion, runningVersion.major, runningVersion.minor+1)
+	}
+	return nil
+}
+
+func getImageK8sVersion(image string) (k8sVersion, error) {
+	named, err := ref.ParseNormalizedNamed(image)
+	if err != nil {
+		return k8sVersion{}, fmt.Errorf("Failed to parse Kubernetes image [%s]: %v", image, err)
+	}
+	tagged, ok := named.(ref.Tagged)
+	if !ok {
+		return k8sVersion{}, fmt.Errorf("Kubernetes image [%s] has no version tag", image)
+	}
+	return parseK8sVersion(tagged.Tag())
+}
+
+func parseK8sVersion(version string) (k8sVersion, error) {
+	matches := k8sVersionRegexp.FindStringSubmatch(version)
+	if matches == nil {
+		return k8sVersion{}, fmt.Errorf("Failed to parse Kubernetes version [%s]", version)
+	}
+	parsed := k8sVersion{}
+	parsed.major, _ = strconv.Atoi(matches[1])
+	parsed.minor, _ = strconv.Atoi(matches[2])
+	parsed.patch, _ = strconv.Atoi(matches[3])
+	return parsed, nil
+}
+
+func (v k8sVersion) less(other k8sVersion) bool {
+	if v.major != other.major {
+		return v.major < other.major
+	}
+	if v.minor != other.minor {
+		return v.minor < other.minor
+	}
+	return v.patch < other.patch
+}
+
+func (v k8sVersion) String() string {
+	return fmt.Sprintf("v%d.%d.%d", v.major, v.minor, v.patch)
+}
@@ -2,9 +2,13 @@ package cluster
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/rancher/rke/hosts"
 	"github.com/rancher/rke/services"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
 )
 
 func (c *Cluster) ValidateCluster() error {
@@ -36,6 +40,16 @@ func (c *Cluster) ValidateCluster() error {
 		return err
 	}
 
+	// validate upgrade strategy options
+	if err := validateUpgradeStrategyOptions(c); err != nil {
+		return err
+	}
+
+	// validate state store options
+	if err := validateStateStoreOptions(c); err != nil {
+		return err
+	}
+
 	// validate services options
 	return validateServicesOptions(c)
 }
@@ -55,10 +69,25 @@ func validateNetworkOptions(c *Cluster) error {
 }
 
 func validateHostsOptions(c *Cluster) error {
+	if c.SSHHostKeyChecking != hosts.StrictHostKeyChecking && c.SSHHostKeyChecking != hosts.TrustOnFirstUseHostKeyChecking && c.SSHHostKeyChecking != hosts.InsecureHostKeyChecking {
+		return fmt.Errorf("SSH host key checking mode [%s] is not supported", c.SSHHostKeyChecking)
+	}
+	if *c.SSHTimeout < 0 || *c.SSHRetries < 0 || *c.SSHRetryBackoff < 0 || *c.SSHMaxRetryBackoff < 0 {
+		return fmt.Errorf("SSH timeout, retries and retry backoff can't be negative")
+	}
+	if err := validateBastionHost(c.BastionHost); err != nil {
+		return err
+	}
 	for i, host := range c.Nodes {
 		if len(host.Address) == 0 {
 			return fmt.Errorf("User for host (%d) is not provided", i+1)
 		}
+		if err := validateSSHPort(host.Port); err != nil {
+			return fmt.Errorf("%v for host (%d)", err, i+1)
+		}
+		if err := validateBastionHost(host.BastionHost); err != nil {
+			return fmt.Errorf("%v for host (%d)", err, i+1)
+		}
 		if len(host.User) == 0 {
 			return fmt.Errorf("User for host (%d) is not provided", i+1)
 		}
@@ -74,6 +103,29 @@ func validateHostsOptions(c *Cluster) error {
 	return nil
 }
 
+func validateBastionHost(bastionHost *v3.BastionHost) error {
+	if bastionHost == nil {
+		return nil
+	}
+	if len(bastionHost.Address) == 0 {
+		return fmt.Errorf("Address of bastion host is not provided")
+	}
+	if len(bastionHost.User) == 0 {
+		return fmt.Errorf("User of bastion host [%s] is not provided", bastionHost.Address)
+	}
+	return validateSSHPort(bastionHost.Port)
+}
+
+func validateSSHPort(port string) error {
+	if len(port) == 0 {
+		return nil
+	}
+	if portNumber, err := strconv.Atoi(port); err != nil || portNumber < 1 || portNumber > 65535 {
+		return fmt.Errorf("SSH port [%s] is not valid", port)
+	}
+	return nil
+}
+
 func validateServicesOptions(c *Cluster) error {
 	servicesOptions := map[string]string{
 		"etcd_image":                               c.Services.Etcd.Image,
@@ -94,6 +146,29 @@ func validateServicesOptions(c *Cluster) error {
 			return fmt.Errorf("%s can't be empty", strings.Join(strings.Split(optionName, "_"), " "))
 		}
 	}
+	if err := validateEtcdSnapshotOptions(c); err != nil {
+		return err
+	}
+	return validateEtcdBackupTargetOptions(c)
+}
+
+func validateEtcdSnapshotOptions(c *Cluster) error {
+	if c.Services.Etcd.Snapshot == nil {
+		return nil
+	}
+	snapshotOptions := map[string]string{
+		"interval":  c.Services.Etcd.Snapshot.Interval,
+		"retention": c.Services.Etcd.Snapshot.Retention,
+	}
+	for optionName, optionValue := range snapshotOptions {
+		duration, err := time.ParseDuration(optionValue)
+		if err != nil {
+			return fmt.Errorf("Etcd snapshot %s [%s] is not a valid duration: %v", optionName, optionValue, err)
+		}
+		if duration < time.Minute {
+			return fmt.Errorf("Etcd snapshot %s [%s] can't be less than one minute", optionName, optionValue)
+		}
+	}
 	return nil
 }
 
@@ -104,3 +179,66 @@ func validateIngressOptions(c *Cluster) error {
 	}
 	return nil
 }
+
+func validateEtcdBackupTargetOptions(c *Cluster) error {
+	if c.Services.Etcd.BackupTarget == nil {
+		return nil
+	}
+	backupTargetOptions := map[string]string{
+		"bucket":     c.Services.Etcd.BackupTarget.Bucket,
+		"access_key": c.Services.Etcd.BackupTarget.AccessKey,
+		"secret_key": c.Services.Etcd.BackupTarget.SecretKey,
+	}
+	for optionName, optionValue := range backupTargetOptions {
+		if len(optionValue) == 0 {
+			return fmt.Errorf("Etcd backup target %s can't be empty", strings.Join(strings.Split(optionName, "_"), " "))
+		}
+	}
+	return nil
+}
+
+func validateUpgradeStrategyOptions(c *Cluster) error {
+	if c.NodeDrain.Timeout < 0 || c.NodeDrain.GracePeriod < 0 {
+		return fmt.Errorf("Node drain timeout and grace period can't be negative")
+	}
+	if c.UpgradeStrategy == nil {
+		return nil
+	}
+	if c.UpgradeStrategy.FailureThreshold < 0 {
+		return fmt.Errorf("Upgrade strategy failure threshold can't be negative")
+	}
+	_, err := services.GetMaxUnavailableWorkers(c.UpgradeStrategy.MaxUnavailableWorker, len(c.WorkerHosts))
+	return err
+}
+
+func validateStateStoreOptions(c *Cluster) error {
+	storeConfig := c.RancherKubernetesEngineConfig.StateStore
+	if storeConfig == nil {
+		return nil
+	}
+	if storeConfig.HistoryLimit < 0 {
+		return fmt.Errorf("State store history limit can't be negative")
+	}
+	switch storeConfig.Type {
+	case "", KubernetesStateStore, LocalStateStore:
+		return nil
+	case HTTPStateStore:
+		if len(storeConfig.URL) == 0 {
+			return fmt.Errorf("State store url can't be empty")
+		}
+		// the state holds the certificates private keys
+		if !strings.HasPrefix(storeConfig.URL, "https://") {
+			return fmt.Errorf("State store url [%s] must use https", storeConfig.URL)
+		}
+		return nil
+	case S3StateStore:
+		if storeConfig.S3 == nil || len(storeConfig.S3.Bucket) == 0 {
+			return fmt.Errorf("State store s3 bucket can't be empty")
+		}
+		if len(storeConfig.Key) == 0 {
+			return fmt.Errorf("State store key can't be empty")
+		}
+		return nil
+	}
+	return fmt.Errorf("State store type [%s] is not supported", storeConfig.Type)
+}
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rancher/rke/cluster"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/pki"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+	"github.com/urfave/cli"
+)
+
+func CertificateCommand() cli.Command {
+	rotateFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  cluster.DefaultClusterConfig,
+			EnvVar: "RKE_CONFIG",
+		},
+		cli.StringFlag{
+			Name:  "service",
+			Usage: fmt.Sprintf("Comma separated list of certificates to rotate, defaults to all of: %s", strings.Join(pki.ComponentCertificates, ",")),
+		},
+		cli.BoolFlag{
+			Name:  "rotate-ca",
+			Usage: "Rotate the cluster CA and reissue all certificates",
+		},
+	}
+	checkFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  cluster.DefaultClusterConfig,
+			EnvVar: "RKE_CONFIG",
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the certificates report in JSON format",
+		},
+	}
+	return cli.Command{
+		Name:  "cert",
+		Usage: "Certificates management for RKE cluster",
+		Subcommands: []cli.Command{
+			{
+				Name:   "rotate",
+				Usage:  "Rotate RKE cluster certificates using the cluster CA",
+				Flags:  rotateFlags,
+				Action: rotateRKECertificatesFromCli,
+			},
+			{
+				Name:   "check",
+				Usage:  "Check RKE cluster certificates expiry and SANs",
+				Flags:  checkFlags,
+				Action: checkRKECertificatesFromCli,
+			},
+		},
+	}
+}
+
+func RotateRKECertificates(
+	ctx context.Context,
+	rkeConfig *v3.RancherKubernetesEngineConfig,
+	dockerDialerFactory, localConnDialerFactory hosts.DialerFactory,
+	configDir string, components []string, rotateCA bool, stateStore cluster.StateStore) error {
+
+	log.Infof(ctx, "Rotating Kubernetes cluster certificates")
+	kubeCluster, err := cluster.ParseCluster(ctx, rkeConfig, clusterFilePath, configDir, dockerDialerFactory, localConnDialerFactory, stateStore)
+	if err != nil {
+		return err
+	}
+	defer kubeCluster.CloseSSHConnections()
+
+	if err := kubeCluster.TunnelHosts(ctx, false); err != nil {
+		return err
+	}
+	if err := kubeCluster.SaveHostKeys(ctx); err != nil {
+		return err
+	}
+
+	currentCluster, err := kubeCluster.GetClusterState(ctx)
+	if err != nil {
+		return err
+	}
+
+	if rotateCA {
+		err = cluster.RotateCACertificates(ctx, kubeCluster, currentCluster)
+	} else {
+		err = cluster.RotateCertificates(ctx, kubeCluster, currentCluster, components)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Infof(ctx, "Finished rotating certificates successfully")
+	return nil
+}
+
+func CheckRKECertificates(
+	ctx context.Context,
+	rkeConfig *v3.RancherKubernetesEngineConfig,
+	dockerDialerFactory, localConnDialerFactory hosts.DialerFactory,
+	configDir string, stateStore cluster.StateStore) ([]pki.CertificateReport, error) {
+
+	kubeCluster, err := cluster.ParseCluster(ctx, rkeConfig, clusterFilePath, configDir, dockerDialerFactory, localConnDialerFactory, stateStore)
+	if err != nil {
+		return nil, err
+	}
+	defer kubeCluster.CloseSSHConnections()
+
+	certificates, err := kubeCluster.GetClusterCertificates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pki.GetCertificatesReport(certificates, kubeCluster.ControlPlaneHosts, kubeCluster.EtcdHosts, time.Now()), nil
+}
+
+func rotateRKECertificatesFromCli(ctx *cli.Context) error {
+	rotateCA := ctx.Bool("rotate-ca")
+	if rotateCA && len(ctx.String("service")) > 0 {
+		return fmt.Errorf("--service can't be used with --rotate-ca, rotating the CA reissues all certificates")
+	}
+	components, err := resolveRotateComponents(ctx.String("service"))
+	if err != nil {
+		return err
+	}
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	clusterFilePath = filePath
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+	return RotateRKECertificates(context.Background(), rkeConfig, nil, nil, "", components, rotateCA, nil)
+}
+
+func checkRKECertificatesFromCli(ctx *cli.Context) error {
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	clusterFilePath = filePath
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+	reports, err := CheckRKECertificates(context.Background(), rkeConfig, nil, nil, "", nil)
+	if err != nil {
+		return err
+	}
+	if ctx.Bool("json") {
+		output, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to encode certificates report: %v", err)
+		}
+		fmt.Println(string(output))
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSUBJECT\tISSUER\tSANS\tEXPIRES\tDAYS REMAINING\tMISSING SANS")
+	for _, report := range reports {
+		sans := append(append([]string{}, report.DNSNames...), report.IPAddresses...)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			report.Name,
+			report.Subject,
+			report.Issuer,
+			strings.Join(sans, ","),
+			report.NotAfter.Format(time.RFC3339),
+			report.DaysRemaining,
+			strings.Join(report.MissingSANs, ","))
+	}
+	return w.Flush()
+}
+
+func resolveRotateComponents(services string) ([]string, error) {
+	if len(services) == 0 {
+		return pki.ComponentCertificates, nil
+	}
+	components := []string{}
+	for _, service := range strings.Split(services, ",") {
+		service = strings.TrimSpace(service)
+		found := false
+		for _, component := range pki.ComponentCertificates {
+			if service == component {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Unknown certificate [%s], supported certificates are: %s", service, strings.Join(pki.ComponentCertificates, ","))
+		}
+		components = append(components, service)
+	}
+	return components, nil
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rancher/rke/cluster"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+	"github.com/urfave/cli"
+)
+
+func EtcdCommand() cli.Command {
+	snapshotFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:  "name",
+			Usage: "Specify Snapshot name",
+		},
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  cluster.DefaultClusterConfig,
+			EnvVar: "RKE_CONFIG",
+		},
+	}
+	return cli.Command{
+		Name:  "etcd",
+		Usage: "etcd snapshot save/restore operations in k8s cluster",
+		Subcommands: []cli.Command{
+			{
+				Name:   "snapshot-save",
+				Usage:  "Take snapshot on all etcd hosts",
+				Flags:  snapshotFlags,
+				Action: snapshotSaveEtcdHostsFromCli,
+			},
+			{
+				Name:   "snapshot-restore",
+				Usage:  "Restore existing snapshot",
+				Flags:  snapshotFlags,
+				Action: restoreEtcdSnapshotFromCli,
+			},
+		},
+	}
+}
+
+func SnapshotSaveEtcdHosts(
+	ctx context.Context,
+	rkeConfig *v3.RancherKubernetesEngineConfig,
+	dockerDialerFactory hosts.DialerFactory,
+	configDir, snapshotName string) error {
+
+	log.Infof(ctx, "Starting saving snapshot on etcd hosts")
+	kubeCluster, err := cluster.ParseCluster(ctx, rkeConfig, clusterFilePath, configDir, dockerDialerFactory, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer kubeCluster.CloseSSHConnections()
+
+	if err := kubeCluster.TunnelHosts(ctx, false); err != nil {
+		return err
+	}
+	if err := kubeCluster.SaveHostKeys(ctx); err != nil {
+		return err
+	}
+
+	if err := kubeCluster.SnapshotEtcd(ctx, snapshotName); err != nil {
+		return err
+	}
+
+	log.Infof(ctx, "Finished saving snapshot [%s] on all etcd hosts", snapshotName)
+	return nil
+}
+
+func RestoreEtcdSnapshot(
+	ctx context.Context,
+	rkeConfig *v3.RancherKubernetesEngineConfig,
+	dockerDialerFactory, localConnDialerFactory hosts.DialerFactory,
+	configDir, snapshotName string) error {
+
+	log.Infof(ctx, "Starting restoring snapshot on etcd hosts")
+	kubeCluster, err := cluster.ParseCluster(ctx, rkeConfig, clusterFilePath, configDir, dockerDialerFactory, localConnDialerFactory, nil)
+	if err != nil {
+		return err
+	}
+	defer kubeCluster.CloseSSHConnections()
+
+	if err := kubeCluster.TunnelHosts(ctx, false); err != nil {
+		return err
+	}
+	if err := kubeCluster.SaveHostKeys(ctx); err != nil {
+		return err
+	}
+
+	if err := kubeCluster.RestoreEtcdSnapshot(ctx, snapshotName); err != nil {
+		return err
+	}
+
+	log.Infof(ctx, "Finished restoring snapshot [%s] on all etcd hosts", snapshotName)
+	return nil
+}
+
+func snapshotSaveEtcdHostsFromCli(ctx *cli.Context) error {
+	rkeConfig, snapshotName, err := resolveSnapshotArgs(ctx)
+	if err != nil {
+		return err
+	}
+	return SnapshotSaveEtcdHosts(context.Background(), rkeConfig, nil, "", snapshotName)
+}
+
+func restoreEtcdSnapshotFromCli(ctx *cli.Context) error {
+	rkeConfig, snapshotName, err := resolveSnapshotArgs(ctx)
+	if err != nil {
+		return err
+	}
+	return RestoreEtcdSnapshot(context.Background(), rkeConfig, nil, nil, "", snapshotName)
+}
+
+func resolveSnapshotArgs(ctx *cli.Context) (*v3.RancherKubernetesEngineConfig, string, error) {
+	snapshotName := ctx.String("name")
+	if len(snapshotName) == 0 {
+		return nil, "", fmt.Errorf("Snapshot name is required, please specify it with --name")
+	}
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	clusterFilePath = filePath
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+	return rkeConfig, snapshotName, nil
+}
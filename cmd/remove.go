@@ -47,15 +47,19 @@ func ClusterRemove(
 	local bool, configDir string) error {
 
 	log.Infof(ctx, "Tearing down Kubernetes cluster")
-	kubeCluster, err := cluster.ParseCluster(ctx, rkeConfig, clusterFilePath, configDir, dialerFactory, nil)
+	kubeCluster, err := cluster.ParseCluster(ctx, rkeConfig, clusterFilePath, configDir, dialerFactory, nil, nil)
 	if err != nil {
 		return err
 	}
+	defer kubeCluster.CloseSSHConnections()
 
 	err = kubeCluster.TunnelHosts(ctx, local)
 	if err != nil {
 		return err
 	}
+	if err := kubeCluster.SaveHostKeys(ctx); err != nil {
+		return err
+	}
 
 	logrus.Debugf("Starting Cluster removal")
 	err = kubeCluster.ClusterRemove(ctx)
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rancher/rke/cluster"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+	"github.com/urfave/cli"
+)
+
+func RollbackCommand() cli.Command {
+	rollbackFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  cluster.DefaultClusterConfig,
+			EnvVar: "RKE_CONFIG",
+		},
+		cli.IntFlag{
+			Name:  "to",
+			Usage: "Revision of the state history to roll back to, see rke state history",
+		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Print the changes that would be applied to the cluster without applying them",
+		},
+		cli.BoolFlag{
+			Name:  "skip-drain",
+			Usage: "Remove nodes from the cluster without draining them",
+		},
+		cli.BoolFlag{
+			Name:  "force",
+			Usage: "Apply etcd membership changes that remove a majority of the members or break the etcd quorum",
+		},
+		cli.BoolFlag{
+			Name:  "skip-version-check",
+			Usage: "Deploy the cluster without checking the Kubernetes version when the Kubernetes API is not reachable",
+		},
+	}
+	return cli.Command{
+		Name:   "rollback",
+		Usage:  "Apply a previous configuration of the cluster state history",
+		Action: clusterRollbackFromCli,
+		Flags:  rollbackFlags,
+	}
+}
+
+func ClusterRollback(
+	ctx context.Context,
+	rkeConfig *v3.RancherKubernetesEngineConfig,
+	dockerDialerFactory, localConnDialerFactory hosts.DialerFactory,
+	configDir string, revision int, stateStore cluster.StateStore) (string, string, string, string, error) {
+
+	revisionConfig, err := getRevisionConfig(ctx, rkeConfig, configDir, revision, stateStore)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	log.Infof(ctx, "Rolling back Kubernetes cluster to revision [%d]", revision)
+	return ClusterUp(ctx, revisionConfig, dockerDialerFactory, localConnDialerFactory, false, configDir, stateStore)
+}
+
+// getRevisionConfig returns the configuration of a revision, the state store of the cluster file is kept
+// so the cluster state is saved in the same place
+func getRevisionConfig(
+	ctx context.Context,
+	rkeConfig *v3.RancherKubernetesEngineConfig,
+	configDir string, revision int, stateStore cluster.StateStore) (*v3.RancherKubernetesEngineConfig, error) {
+
+	kubeCluster, err := cluster.ParseCluster(ctx, rkeConfig, clusterFilePath, configDir, nil, nil, stateStore)
+	if err != nil {
+		return nil, err
+	}
+	revisionConfig, err := kubeCluster.GetStateRevision(ctx, revision)
+	if err != nil {
+		return nil, err
+	}
+	revisionConfig.StateStore = rkeConfig.StateStore
+	return revisionConfig, nil
+}
+
+func clusterRollbackFromCli(ctx *cli.Context) error {
+	if !ctx.IsSet("to") {
+		return fmt.Errorf("Revision to roll back to is not provided, use --to")
+	}
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	clusterFilePath = filePath
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+	rollbackCtx := cluster.SetRKEVersion(context.Background(), ctx.App.Version)
+	revision := ctx.Int("to")
+	revisionConfig, err := getRevisionConfig(rollbackCtx, rkeConfig, "", revision, nil)
+	if err != nil {
+		return err
+	}
+	if ctx.Bool("dry-run") {
+		plan, err := ClusterUpPlan(rollbackCtx, revisionConfig, nil, nil, false, "", nil)
+		if err != nil {
+			return err
+		}
+		printClusterPlan(plan)
+		return nil
+	}
+	log.Infof(rollbackCtx, "Rolling back Kubernetes cluster to revision [%d]", revision)
+	if _, _, _, _, err = clusterUp(rollbackCtx, revisionConfig, nil, nil, false, "", getUpOptions(ctx)); err != nil {
+		return err
+	}
+	log.Warnf(rollbackCtx, "Cluster file [%s] wasn't changed by the rollback, update it before running rke up again", clusterFilePath)
+	return nil
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/rke/cluster"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+)
+
+func TestGetRevisionConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rke-rollback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	clusterFilePath = filepath.Join(dir, cluster.DefaultClusterConfig)
+	defer func() { clusterFilePath = "" }()
+
+	stateStore := &v3.StateStoreConfig{
+		Type: cluster.LocalStateStore,
+		Path: filepath.Join(dir, "remote.rkestate"),
+	}
+	rkeConfig := getTestRollbackConfig("v1.8.10", stateStore)
+	ctx := context.Background()
+	kubeCluster, err := cluster.ParseCluster(ctx, rkeConfig, clusterFilePath, "", nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{"v1.8.9", "v1.8.10"} {
+		// the revisions were applied with another state store configuration
+		if err := kubeCluster.SaveStateRevision(ctx, getTestRollbackConfig(version, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	revisionConfig, err := getRevisionConfig(ctx, rkeConfig, "", 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, revisionConfig.SystemImages.Kubernetes, "rancher/k8s:v1.8.9", "Failed to get configuration of revision [1]")
+	assertEqual(t, revisionConfig.StateStore, stateStore, "Failed to keep the state store of the cluster file")
+
+	if _, err := getRevisionConfig(ctx, rkeConfig, "", 3, nil); err == nil {
+		t.Fatal("Failed to reject revision missing from the state history")
+	}
+}
+
+func getTestRollbackConfig(version string, stateStore *v3.StateStoreConfig) *v3.RancherKubernetesEngineConfig {
+	rkeConfig := &v3.RancherKubernetesEngineConfig{
+		Nodes: []v3.RKEConfigNode{
+			{
+				Address: "1.1.1.1",
+				User:    "rke",
+				Role:    []string{"etcd", "controlplane", "worker"},
+			},
+		},
+		StateStore: stateStore,
+	}
+	rkeConfig.SystemImages.Kubernetes = "rancher/k8s:" + version
+	return rkeConfig
+}
+
+func assertEqual(t *testing.T, a interface{}, b interface{}, message string) {
+	if a == b {
+		return
+	}
+	if len(message) == 0 {
+		message = fmt.Sprintf("%v != %v", a, b)
+	}
+	t.Fatal(message)
+}
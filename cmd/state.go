@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rancher/rke/cluster"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+	"github.com/urfave/cli"
+)
+
+func StateCommand() cli.Command {
+	stateFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  cluster.DefaultClusterConfig,
+			EnvVar: "RKE_CONFIG",
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the state history in JSON format",
+		},
+	}
+	return cli.Command{
+		Name:  "state",
+		Usage: "Cluster state operations",
+		Subcommands: []cli.Command{
+			{
+				Name:   "history",
+				Usage:  "List the configurations applied to the cluster",
+				Flags:  stateFlags,
+				Action: clusterStateHistoryFromCli,
+			},
+		},
+	}
+}
+
+func ClusterStateHistory(
+	ctx context.Context,
+	rkeConfig *v3.RancherKubernetesEngineConfig,
+	configDir string, stateStore cluster.StateStore) ([]cluster.StateRevision, error) {
+
+	kubeCluster, err := cluster.ParseCluster(ctx, rkeConfig, clusterFilePath, configDir, nil, nil, stateStore)
+	if err != nil {
+		return nil, err
+	}
+	return kubeCluster.GetStateHistory(ctx)
+}
+
+func clusterStateHistoryFromCli(ctx *cli.Context) error {
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	clusterFilePath = filePath
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+	history, err := ClusterStateHistory(context.Background(), rkeConfig, "", nil)
+	if err != nil {
+		return err
+	}
+	if ctx.Bool("json") {
+		output, err := json.MarshalIndent(history, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to encode cluster state history: %v", err)
+		}
+		fmt.Println(string(output))
+		return nil
+	}
+	return printStateHistory(history)
+}
+
+func printStateHistory(history []cluster.StateRevision) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REVISION\tAPPLIED\tRKE VERSION\tCONFIG HASH\tCURRENT")
+	for i, revision := range history {
+		configHash := revision.ConfigHash
+		if len(configHash) > 12 {
+			configHash = configHash[:12]
+		}
+		current := ""
+		if i == len(history)-1 {
+			current = "*"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n",
+			revision.Revision,
+			revision.Timestamp.Format(time.RFC3339),
+			orDash(revision.RKEVersion),
+			configHash,
+			current)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/rancher/rke/cluster"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+	"github.com/urfave/cli"
+)
+
+func StatusCommand() cli.Command {
+	statusFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  cluster.DefaultClusterConfig,
+			EnvVar: "RKE_CONFIG",
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the cluster status in JSON format",
+		},
+	}
+	return cli.Command{
+		Name:   "status",
+		Usage:  "Show the status of RKE containers, etcd members and Kubernetes nodes",
+		Action: clusterStatusFromCli,
+		Flags:  statusFlags,
+	}
+}
+
+func ClusterStatus(
+	ctx context.Context,
+	rkeConfig *v3.RancherKubernetesEngineConfig,
+	dockerDialerFactory, localConnDialerFactory hosts.DialerFactory,
+	configDir string, stateStore cluster.StateStore) (*cluster.Status, error) {
+
+	kubeCluster, err := cluster.ParseCluster(ctx, rkeConfig, clusterFilePath, configDir, dockerDialerFactory, localConnDialerFactory, stateStore)
+	if err != nil {
+		return nil, err
+	}
+	defer kubeCluster.CloseSSHConnections()
+	return cluster.GetClusterStatus(ctx, kubeCluster)
+}
+
+func clusterStatusFromCli(ctx *cli.Context) error {
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	clusterFilePath = filePath
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+	status, err := ClusterStatus(context.Background(), rkeConfig, nil, nil, "", nil)
+	if err != nil {
+		return err
+	}
+	if ctx.Bool("json") {
+		output, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to encode cluster status: %v", err)
+		}
+		fmt.Println(string(output))
+		return nil
+	}
+	return printClusterStatus(status)
+}
+
+func printClusterStatus(status *cluster.Status) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tCONTAINER\tSTATE\tIMAGE\tRESTARTS\tUPTIME\tHEALTH")
+	for _, container := range status.Containers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			container.Host,
+			container.Name,
+			container.State,
+			orDash(container.Image),
+			container.RestartCount,
+			orDash(container.Uptime),
+			orDash(container.Health))
+	}
+	if len(status.EtcdMembers) > 0 {
+		fmt.Fprintln(w, "\nHOST\tETCD MEMBER\tJOINED\tHEALTHY")
+		for _, member := range status.EtcdMembers {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", member.Host, member.Name, strconv.FormatBool(member.Member), strconv.FormatBool(member.Healthy))
+		}
+	}
+	if len(status.Nodes) > 0 {
+		fmt.Fprintln(w, "\nHOST\tNODE\tREGISTERED\tREADY")
+		for _, node := range status.Nodes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", node.Host, node.NodeName, strconv.FormatBool(node.Registered), strconv.FormatBool(node.Ready))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, container := range status.Containers {
+		if len(container.HealthError) > 0 {
+			fmt.Printf("\n[%s] on host [%s]: %s", container.Name, container.Host, container.HealthError)
+		}
+	}
+	for _, member := range status.EtcdMembers {
+		if len(member.Error) > 0 {
+			fmt.Printf("\n[%s] on host [%s]: %s", member.Name, member.Host, member.Error)
+		}
+	}
+	for _, statusErr := range status.Errors {
+		fmt.Printf("\n%s", statusErr)
+	}
+	fmt.Println()
+	return nil
+}
+
+func orDash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
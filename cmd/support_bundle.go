@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rancher/rke/cluster"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+	"github.com/urfave/cli"
+)
+
+func SupportBundleCommand() cli.Command {
+	supportBundleFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  cluster.DefaultClusterConfig,
+			EnvVar: "RKE_CONFIG",
+		},
+		cli.StringFlag{
+			Name:  "output",
+			Usage: "Specify the support bundle archive path, defaults to rke-support-bundle-<timestamp>.tar.gz",
+		},
+	}
+	return cli.Command{
+		Name:   "support-bundle",
+		Usage:  "Collect the diagnostics of the cluster hosts and Kubernetes in a tar.gz archive",
+		Action: supportBundleFromCli,
+		Flags:  supportBundleFlags,
+	}
+}
+
+func SupportBundle(
+	ctx context.Context,
+	rkeConfig *v3.RancherKubernetesEngineConfig,
+	dockerDialerFactory, localConnDialerFactory hosts.DialerFactory,
+	configDir, outputPath string) error {
+
+	log.Infof(ctx, "Collecting support bundle")
+	kubeCluster, err := cluster.ParseCluster(ctx, rkeConfig, clusterFilePath, configDir, dockerDialerFactory, localConnDialerFactory, nil)
+	if err != nil {
+		return err
+	}
+	defer kubeCluster.CloseSSHConnections()
+	outputFile, err := os.OpenFile(outputPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("Failed to create support bundle [%s]: %v", outputPath, err)
+	}
+	defer outputFile.Close()
+	if err := cluster.WriteSupportBundle(ctx, kubeCluster, outputFile); err != nil {
+		return err
+	}
+	log.Infof(ctx, "Finished writing support bundle [%s]", outputPath)
+	return nil
+}
+
+func supportBundleFromCli(ctx *cli.Context) error {
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	clusterFilePath = filePath
+
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+	outputPath := ctx.String("output")
+	if len(outputPath) == 0 {
+		outputPath = fmt.Sprintf("%s-%s.tar.gz", cluster.SupportBundleDir, time.Now().Format("20060102150405"))
+	}
+	return SupportBundle(context.Background(), rkeConfig, nil, nil, "", outputPath)
+}
@@ -15,6 +15,15 @@ import (
 
 var clusterFilePath string
 
+// upOptions are the options of a single run, they aren't saved in the cluster state
+type upOptions struct {
+	stateStore            cluster.StateStore
+	resume                bool
+	skipDrain             bool
+	forceMembershipChange bool
+	skipVersionCheck      bool
+}
+
 func UpCommand() cli.Command {
 	upFlags := []cli.Flag{
 		cli.StringFlag{
@@ -27,6 +36,30 @@ func UpCommand() cli.Command {
 			Name:  "local",
 			Usage: "Deploy Kubernetes cluster locally",
 		},
+		cli.StringFlag{
+			Name:  "custom-certs-dir",
+			Usage: "Specify a directory of custom certificates to use instead of generating them",
+		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Print the changes that would be applied to the cluster without applying them",
+		},
+		cli.BoolFlag{
+			Name:  "skip-drain",
+			Usage: "Remove nodes from the cluster without draining them",
+		},
+		cli.BoolFlag{
+			Name:  "resume",
+			Usage: "Resume a failed run, skipping the phases it completed if cluster.yml didn't change",
+		},
+		cli.BoolFlag{
+			Name:  "force",
+			Usage: "Apply etcd membership changes that remove a majority of the members or break the etcd quorum",
+		},
+		cli.BoolFlag{
+			Name:  "skip-version-check",
+			Usage: "Deploy the cluster without checking the Kubernetes version when the Kubernetes API is not reachable",
+		},
 	}
 	return cli.Command{
 		Name:   "up",
@@ -36,30 +69,59 @@ func UpCommand() cli.Command {
 	}
 }
 
+// ClusterUp brings the cluster up, the cluster state is kept in stateStore, or in the state_store configuration if it's nil
 func ClusterUp(
 	ctx context.Context,
 	rkeConfig *v3.RancherKubernetesEngineConfig,
 	dockerDialerFactory, localConnDialerFactory hosts.DialerFactory,
-	local bool, configDir string) (string, string, string, string, error) {
+	local bool, configDir string, stateStore cluster.StateStore) (string, string, string, string, error) {
+
+	return clusterUp(ctx, rkeConfig, dockerDialerFactory, localConnDialerFactory, local, configDir, upOptions{stateStore: stateStore})
+}
+
+// clusterUp records the completed phases in a checkpoint file, resume skips the phases completed by a failed run
+func clusterUp(
+	ctx context.Context,
+	rkeConfig *v3.RancherKubernetesEngineConfig,
+	dockerDialerFactory, localConnDialerFactory hosts.DialerFactory,
+	local bool, configDir string, opts upOptions) (string, string, string, string, error) {
 
 	log.Infof(ctx, "Building Kubernetes cluster")
 	var APIURL, caCrt, clientCert, clientKey string
-	kubeCluster, err := cluster.ParseCluster(ctx, rkeConfig, clusterFilePath, configDir, dockerDialerFactory, localConnDialerFactory)
+	kubeCluster, err := cluster.ParseCluster(ctx, rkeConfig, clusterFilePath, configDir, dockerDialerFactory, localConnDialerFactory, opts.stateStore)
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, err
 	}
+	defer kubeCluster.CloseSSHConnections()
+	kubeCluster.SkipDrain = opts.skipDrain
+	kubeCluster.ForceMembershipChange = opts.forceMembershipChange
+	kubeCluster.SkipVersionCheck = opts.skipVersionCheck
 
 	err = kubeCluster.TunnelHosts(ctx, local)
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, err
 	}
+	if err := kubeCluster.SaveHostKeys(ctx); err != nil {
+		return APIURL, caCrt, clientCert, clientKey, err
+	}
 
 	currentCluster, err := kubeCluster.GetClusterState(ctx)
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, err
 	}
 
-	if err = kubeCluster.CheckClusterPorts(ctx, currentCluster); err != nil {
+	if err := kubeCluster.SetUpCheckpoint(ctx, currentCluster, opts.resume); err != nil {
+		return APIURL, caCrt, clientCert, clientKey, err
+	}
+
+	if err := kubeCluster.SetUpKubernetesUpgrade(ctx, currentCluster); err != nil {
+		return APIURL, caCrt, clientCert, clientKey, err
+	}
+
+	err = kubeCluster.RunPhase(ctx, cluster.PhaseCheckPorts, func() error {
+		return kubeCluster.CheckClusterPorts(ctx, currentCluster)
+	})
+	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, err
 	}
 
@@ -68,50 +130,86 @@ func ClusterUp(
 		return APIURL, caCrt, clientCert, clientKey, err
 	}
 
-	err = cluster.ReconcileCluster(ctx, kubeCluster, currentCluster)
+	err = kubeCluster.SaveDesiredState(ctx, rkeConfig)
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, err
 	}
 
-	err = kubeCluster.SetUpHosts(ctx)
+	err = kubeCluster.RunPhase(ctx, cluster.PhaseReconcile, func() error {
+		return cluster.ReconcileCluster(ctx, kubeCluster, currentCluster)
+	})
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, err
 	}
 
-	if err := kubeCluster.PrePullK8sImages(ctx); err != nil {
+	err = kubeCluster.RunPhase(ctx, cluster.PhaseCertificates, func() error {
+		return kubeCluster.SetUpHosts(ctx)
+	})
+	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, err
 	}
 
-	err = kubeCluster.DeployControlPlane(ctx)
+	err = kubeCluster.RunPhase(ctx, cluster.PhasePullImages, func() error {
+		return kubeCluster.PrePullK8sImages(ctx)
+	})
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, err
 	}
 
-	err = kubeCluster.SaveClusterState(ctx, rkeConfig)
+	err = kubeCluster.RunPhase(ctx, cluster.PhaseControlPlane, func() error {
+		return kubeCluster.DeployControlPlane(ctx)
+	})
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, err
 	}
 
-	err = kubeCluster.DeployWorkerPlane(ctx)
+	err = kubeCluster.RunPhase(ctx, cluster.PhaseSaveState, func() error {
+		return kubeCluster.SaveClusterState(ctx, rkeConfig)
+	})
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, err
 	}
 
-	err = kubeCluster.DeployNetworkPlugin(ctx)
+	err = kubeCluster.RunPhase(ctx, cluster.PhaseWorkerPlane, func() error {
+		return kubeCluster.DeployWorkerPlane(ctx)
+	})
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, err
 	}
 
-	err = kubeCluster.SyncLabelsAndTaints(ctx)
+	if err := kubeCluster.FinishKubernetesUpgrade(ctx); err != nil {
+		return APIURL, caCrt, clientCert, clientKey, err
+	}
+
+	err = kubeCluster.RunPhase(ctx, cluster.PhaseNetworkPlugin, func() error {
+		return kubeCluster.DeployNetworkPlugin(ctx)
+	})
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, err
 	}
 
-	err = kubeCluster.DeployAddons(ctx)
+	err = kubeCluster.RunPhase(ctx, cluster.PhaseLabels, func() error {
+		return kubeCluster.SyncLabelsAndTaints(ctx)
+	})
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, err
 	}
 
+	err = kubeCluster.RunPhase(ctx, cluster.PhaseAddons, func() error {
+		return kubeCluster.DeployAddons(ctx)
+	})
+	if err != nil {
+		return APIURL, caCrt, clientCert, clientKey, err
+	}
+
+	if err := kubeCluster.SaveStateRevision(ctx, rkeConfig); err != nil {
+		log.Warnf(ctx, "[state] Failed to save cluster state history: %v", err)
+	}
+
+	if err := kubeCluster.RemoveCheckpoint(); err != nil {
+		return APIURL, caCrt, clientCert, clientKey, err
+	}
+
 	APIURL = fmt.Sprintf("https://" + kubeCluster.ControlPlaneHosts[0].Address + ":6443")
 	caCrt = string(cert.EncodeCertPEM(kubeCluster.Certificates[pki.CACertName].Certificate))
 	clientCert = string(cert.EncodeCertPEM(kubeCluster.Certificates[pki.KubeAdminCertName].Certificate))
@@ -121,6 +219,27 @@ func ClusterUp(
 	return APIURL, caCrt, clientCert, clientKey, nil
 }
 
+// ClusterUpPlan connects to the hosts and the cluster to build the plan of ClusterUp, without changing them
+func ClusterUpPlan(
+	ctx context.Context,
+	rkeConfig *v3.RancherKubernetesEngineConfig,
+	dockerDialerFactory, localConnDialerFactory hosts.DialerFactory,
+	local bool, configDir string, stateStore cluster.StateStore) (*cluster.Plan, error) {
+
+	log.Infof(ctx, "Planning Kubernetes cluster changes")
+	kubeCluster, err := cluster.ParseCluster(ctx, rkeConfig, clusterFilePath, configDir, dockerDialerFactory, localConnDialerFactory, stateStore)
+	if err != nil {
+		return nil, err
+	}
+	defer kubeCluster.CloseSSHConnections()
+
+	if err := kubeCluster.TunnelHosts(ctx, local); err != nil {
+		return nil, err
+	}
+
+	return cluster.GetClusterPlan(ctx, kubeCluster)
+}
+
 func clusterUpFromCli(ctx *cli.Context) error {
 	if ctx.Bool("local") {
 		return clusterUpLocal(ctx)
@@ -135,7 +254,18 @@ func clusterUpFromCli(ctx *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("Failed to parse cluster file: %v", err)
 	}
-	_, _, _, _, err = ClusterUp(context.Background(), rkeConfig, nil, nil, false, "")
+	if customCertsDir := ctx.String("custom-certs-dir"); len(customCertsDir) > 0 {
+		rkeConfig.CustomCertsDir = customCertsDir
+	}
+	if ctx.Bool("dry-run") {
+		plan, err := ClusterUpPlan(context.Background(), rkeConfig, nil, nil, false, "", nil)
+		if err != nil {
+			return err
+		}
+		printClusterPlan(plan)
+		return nil
+	}
+	_, _, _, _, err = clusterUp(cluster.SetRKEVersion(context.Background(), ctx.App.Version), rkeConfig, nil, nil, false, "", getUpOptions(ctx))
 	return err
 }
 
@@ -153,6 +283,49 @@ func clusterUpLocal(ctx *cli.Context) error {
 		}
 		rkeConfig.Nodes = []v3.RKEConfigNode{*cluster.GetLocalRKENodeConfig()}
 	}
-	_, _, _, _, err = ClusterUp(context.Background(), rkeConfig, nil, hosts.LocalHealthcheckFactory, true, "")
+	_, _, _, _, err = clusterUp(cluster.SetRKEVersion(context.Background(), ctx.App.Version), rkeConfig, nil, hosts.LocalHealthcheckFactory, true, "", getUpOptions(ctx))
 	return err
 }
+
+func getUpOptions(ctx *cli.Context) upOptions {
+	return upOptions{
+		resume:                ctx.Bool("resume"),
+		skipDrain:             ctx.Bool("skip-drain"),
+		forceMembershipChange: ctx.Bool("force"),
+		skipVersionCheck:      ctx.Bool("skip-version-check"),
+	}
+}
+
+func printClusterPlan(plan *cluster.Plan) {
+	fmt.Println("Hosts:")
+	for _, host := range plan.Hosts {
+		fmt.Printf("  %s [%s] %s\n", host.Action, host.Role, host.Address)
+	}
+	fmt.Println("Containers:")
+	for _, container := range plan.Containers {
+		fmt.Printf("  %s [%s] on host [%s]\n", container.Action, container.Name, container.Host)
+		if container.OldImage != container.NewImage && container.Action == cluster.PlanActionUpgrade {
+			fmt.Printf("      image: %s -> %s\n", container.OldImage, container.NewImage)
+		}
+		for _, arg := range container.RemovedArgs {
+			fmt.Printf("      - %s\n", arg)
+		}
+		for _, arg := range container.AddedArgs {
+			fmt.Printf("      + %s\n", arg)
+		}
+	}
+	fmt.Println("Addons:")
+	for _, addon := range plan.Addons {
+		fmt.Printf("  %s ConfigMap [%s]\n", addon.Action, addon.Name)
+	}
+	fmt.Println("Certificates:")
+	for _, certificate := range plan.Certificates {
+		fmt.Printf("  [%s] %s\n", certificate.Name, certificate.Reason)
+	}
+	if len(plan.HostKeys) > 0 {
+		fmt.Println("SSH host keys trusted on first use:")
+		for _, hostKey := range plan.HostKeys {
+			fmt.Printf("  [%s] %s\n", hostKey.Address, hostKey.Key)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/rancher/rke/cluster"
+	"github.com/rancher/rke/k8s"
 	"github.com/urfave/cli"
 )
 
@@ -26,10 +28,33 @@ func VersionCommand() cli.Command {
 
 func getClusterVersion(ctx *cli.Context) error {
 	localKubeConfig := cluster.GetLocalKubeConfig(ctx.String("config"), "")
-	serverVersion, err := cluster.GetK8sVersion(localKubeConfig)
+	k8sDialer, err := getK8sDialer(ctx)
+	if err != nil {
+		return err
+	}
+	serverVersion, err := cluster.GetK8sVersion(localKubeConfig, k8sDialer)
 	if err != nil {
 		return err
 	}
 	fmt.Printf("Server Version: %s\n", serverVersion)
 	return nil
 }
+
+// getK8sDialer returns the dialer reaching the Kubernetes API through the bastion host of the cluster file, the API is
+// dialed directly if the cluster file doesn't exist
+func getK8sDialer(ctx *cli.Context) (k8s.DialFunc, error) {
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return nil, nil
+	}
+	clusterFilePath = filePath
+	rkeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+	kubeCluster, err := cluster.ParseCluster(context.Background(), rkeConfig, clusterFilePath, "", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return kubeCluster.K8sDialer, nil
+}
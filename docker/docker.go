@@ -4,6 +4,7 @@ import (
 	"archive/tar"
 	"context"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -231,6 +232,14 @@ func StopContainer(ctx context.Context, dClient *client.Client, hostname string,
 	return nil
 }
 
+func RestartContainer(ctx context.Context, dClient *client.Client, hostname string, containerName string) error {
+	err := dClient.ContainerRestart(ctx, containerName, nil)
+	if err != nil {
+		return fmt.Errorf("Can't restart Docker container [%s] for host [%s]: %v", containerName, hostname, err)
+	}
+	return nil
+}
+
 func RenameContainer(ctx context.Context, dClient *client.Client, hostname string, oldContainerName string, newContainerName string) error {
 	err := dClient.ContainerRename(ctx, oldContainerName, newContainerName)
 	if err != nil {
@@ -331,9 +340,77 @@ func ReadFileFromContainer(ctx context.Context, dClient *client.Client, hostname
 	return string(file), nil
 }
 
+func ReadFileStreamFromContainer(ctx context.Context, dClient *client.Client, hostname, container, filePath string) (io.ReadCloser, int64, error) {
+	reader, _, err := dClient.CopyFromContainer(ctx, container, filePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to copy file [%s] from container [%s] on host [%s]: %v", filePath, container, hostname, err)
+	}
+	tarReader := tar.NewReader(reader)
+	header, err := tarReader.Next()
+	if err != nil {
+		reader.Close()
+		return nil, 0, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{tarReader, reader}, header.Size, nil
+}
+
+func WriteFileToContainer(ctx context.Context, dClient *client.Client, hostname, container, dirPath, fileName string, content io.Reader, size int64) error {
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		tarWriter := tar.NewWriter(pipeWriter)
+		err := tarWriter.WriteHeader(&tar.Header{
+			Name: fileName,
+			Mode: 0600,
+			Size: size,
+		})
+		if err == nil {
+			_, err = io.Copy(tarWriter, content)
+		}
+		if err == nil {
+			err = tarWriter.Close()
+		}
+		pipeWriter.CloseWithError(err)
+	}()
+	if err := dClient.CopyToContainer(ctx, container, dirPath, pipeReader, types.CopyToContainerOptions{}); err != nil {
+		pipeReader.CloseWithError(err)
+		return fmt.Errorf("Failed to copy file [%s] to container [%s] on host [%s]: %v", fileName, container, hostname, err)
+	}
+	return nil
+}
+
 func ReadContainerLogs(ctx context.Context, dClient *client.Client, containerName string) (io.ReadCloser, error) {
-	return dClient.ContainerLogs(ctx, containerName, types.ContainerLogsOptions{ShowStdout: true})
+	return dClient.ContainerLogs(ctx, containerName, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
+
+}
 
+// DemuxContainerLogs copies the logs of a container started without a TTY, which docker multiplexes
+// in frames of an 8 bytes header holding the stream type and the frame size, followed by the frame
+func DemuxContainerLogs(dst io.Writer, logs io.Reader) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(logs, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		frameSize := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(dst, logs, frameSize); err != nil {
+			return err
+		}
+	}
+}
+
+// CopyDirFromContainer returns a tar stream of the directory content
+func CopyDirFromContainer(ctx context.Context, dClient *client.Client, hostname, container, dirPath string) (io.ReadCloser, error) {
+	reader, _, err := dClient.CopyFromContainer(ctx, container, dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to copy directory [%s] from container [%s] on host [%s]: %v", dirPath, container, hostname, err)
+	}
+	return reader, nil
 }
 
 func tryRegistryAuth(pr v3.PrivateRegistry) types.RequestPrivilegeFunc {
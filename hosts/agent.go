@@ -0,0 +1,52 @@
+package hosts
+
+import (
+	"fmt"
+	"io"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// agentSigner signs with a key held by the ssh-agent, a new agent connection is used for each request so the signer
+// stays usable when the SSH client reconnects
+type agentSigner struct {
+	socket string
+	pubKey ssh.PublicKey
+}
+
+// getAgentSigners returns a signer for each key held by the ssh-agent listening on the socket
+func getAgentSigners(socket string) ([]ssh.Signer, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to ssh-agent: %v", err)
+	}
+	defer conn.Close()
+	agentSigners, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get ssh-agent keys: %v", err)
+	}
+	signers := []ssh.Signer{}
+	for _, signer := range agentSigners {
+		signers = append(signers, &agentSigner{
+			socket: socket,
+			pubKey: signer.PublicKey(),
+		})
+	}
+	return signers, nil
+}
+
+func (s *agentSigner) PublicKey() ssh.PublicKey {
+	return s.pubKey
+}
+
+func (s *agentSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	conn, err := net.Dial("unix", s.socket)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to ssh-agent: %v", err)
+	}
+	defer conn.Close()
+	// the ssh-agent has its own entropy source
+	return agent.NewClient(conn).Sign(s.pubKey, data)
+}
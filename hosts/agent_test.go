@@ -0,0 +1,77 @@
+package hosts
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const TestAgentSignedData = "rke-agent-test"
+
+func TestGetAgentSigners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rke-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	keyring := agent.NewKeyring()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Add(agent.AddedKey{PrivateKey: privateKey}); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+
+	signers, err := getAgentSigners(socket)
+	if err != nil {
+		t.Fatalf("Failed to get ssh-agent signers: %v", err)
+	}
+	assertEqual(t, len(signers), 1, "Failed to get the key of the ssh-agent")
+	publicKey, err := ssh.NewPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, ssh.FingerprintSHA256(signers[0].PublicKey()), ssh.FingerprintSHA256(publicKey), "Failed to verify the key of the ssh-agent")
+	// each signature uses a new agent connection
+	for i := 0; i < 2; i++ {
+		signature, err := signers[0].Sign(rand.Reader, []byte(TestAgentSignedData))
+		if err != nil {
+			t.Fatalf("Failed to sign with the ssh-agent: %v", err)
+		}
+		if err := publicKey.Verify([]byte(TestAgentSignedData), signature); err != nil {
+			t.Fatalf("Failed to verify the ssh-agent signature: %v", err)
+		}
+	}
+
+	if _, err := getAgentSigners(filepath.Join(dir, "missing.sock")); err == nil {
+		t.Fatal("Failed to return the error of a missing ssh-agent socket")
+	}
+}
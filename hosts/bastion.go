@@ -0,0 +1,90 @@
+package hosts
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+	"golang.org/x/crypto/ssh"
+)
+
+const DefaultSSHPort = "22"
+
+// Bastion is an SSH jump host used to reach the hosts and the Kubernetes API
+type Bastion struct {
+	host    *Host
+	sshAddr string
+	signers []ssh.Signer
+	conn    *sshConnection
+	lock    sync.Mutex
+}
+
+// NewBastion returns the bastion host of the configuration, its host key is verified like the host keys of the hosts.
+// Its SSH connection is kept in the SSH pool of the cluster
+func NewBastion(bastionHost v3.BastionHost, knownHosts *KnownHosts, sshOptions SSHOptions, sshPool *SSHPool) *Bastion {
+	host := &Host{
+		RKEConfigNode: v3.RKEConfigNode{
+			Address:      bastionHost.Address,
+			Port:         bastionHost.Port,
+			User:         bastionHost.User,
+			SSHKey:       bastionHost.SSHKey,
+			SSHKeyPath:   bastionHost.SSHKeyPath,
+			SSHAgentAuth: bastionHost.SSHAgentAuth,
+			SSHHostKey:   bastionHost.SSHHostKey,
+		},
+		KnownHosts: knownHosts,
+		SSHOptions: sshOptions,
+		SSHPool:    sshPool,
+	}
+	bastion := &Bastion{
+		host:    host,
+		sshAddr: host.sshAddr(),
+	}
+	bastion.conn = sshPool.getSSHConnection(bastion.name())
+	return bastion
+}
+
+// Dial opens a connection to the address from the bastion host, over the pooled SSH connection of the bastion host.
+// The connection errors of the bastion host are returned as SSH errors
+func (b *Bastion) Dial(network, address string) (net.Conn, error) {
+	conn, err := b.conn.Dial(network, address, b.newSSHClient)
+	if err != nil {
+		if _, ok := err.(*SSHError); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("Failed to dial [%s] through bastion host [%s]: %v", address, b.sshAddr, err)
+	}
+	return conn, nil
+}
+
+func (b *Bastion) name() string {
+	return sshConnectionName(b.host.User, b.sshAddr, nil)
+}
+
+func (b *Bastion) newSSHClient() (*ssh.Client, error) {
+	signers, err := b.getSSHSigners()
+	if err != nil {
+		return nil, &SSHError{
+			Type:    SSHAuthError,
+			Address: b.sshAddr,
+			Err:     fmt.Errorf("Failed to get SSH credentials for bastion host [%s]: %v", b.host.Address, err),
+		}
+	}
+	return b.host.newSSHClient(signers)
+}
+
+// getSSHSigners reads the credentials of the bastion host once, since it is shared by the hosts
+func (b *Bastion) getSSHSigners() ([]ssh.Signer, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.signers != nil {
+		return b.signers, nil
+	}
+	signers, err := b.host.getSSHSigners()
+	if err != nil {
+		return nil, err
+	}
+	b.signers = signers
+	return signers, nil
+}
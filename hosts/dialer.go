@@ -11,50 +11,42 @@ import (
 type DialerFactory func(h *Host) (func(network, address string) (net.Conn, error), error)
 
 type dialer struct {
-	host   *Host
-	signer ssh.Signer
+	host    *Host
+	signers []ssh.Signer
+	conn    *sshConnection
 }
 
 func SSHFactory(h *Host) (func(network, address string) (net.Conn, error), error) {
-	key, err := h.checkEncryptedKey()
+	signers, err := h.getSSHSigners()
 	if err != nil {
-		return nil, fmt.Errorf("Failed to parse the private key: %v", err)
+		return nil, fmt.Errorf("Failed to get SSH credentials for host [%s]: %v", h.Address, err)
 	}
 	dialer := &dialer{
-		host:   h,
-		signer: key,
+		host:    h,
+		signers: signers,
+		conn:    h.getSSHConnection(),
 	}
 	return dialer.DialDocker, nil
 }
 
 func LocalConnFactory(h *Host) (func(network, address string) (net.Conn, error), error) {
-	key, err := h.checkEncryptedKey()
+	signers, err := h.getSSHSigners()
 	if err != nil {
-		return nil, fmt.Errorf("Failed to parse the private key: %v", err)
+		return nil, fmt.Errorf("Failed to get SSH credentials for host [%s]: %v", h.Address, err)
 	}
 	dialer := &dialer{
-		host:   h,
-		signer: key,
+		host:    h,
+		signers: signers,
+		conn:    h.getSSHConnection(),
 	}
 	return dialer.DialLocalConn, nil
 }
 
 func (d *dialer) DialDocker(network, addr string) (net.Conn, error) {
-	sshAddr := d.host.Address + ":22"
-	// Build SSH client configuration
-	cfg, err := makeSSHConfig(d.host.User, d.signer)
-	if err != nil {
-		return nil, fmt.Errorf("Error configuring SSH: %v", err)
-	}
-	// Establish connection with SSH server
-	conn, err := ssh.Dial("tcp", sshAddr, cfg)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to dial ssh using address [%s]: %v", sshAddr, err)
-	}
 	if len(d.host.DockerSocket) == 0 {
 		d.host.DockerSocket = "/var/run/docker.sock"
 	}
-	remote, err := conn.Dial("unix", d.host.DockerSocket)
+	remote, err := d.conn.Dial("unix", d.host.DockerSocket, d.connect)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to dial to Docker socket: %v", err)
 	}
@@ -62,24 +54,22 @@ func (d *dialer) DialDocker(network, addr string) (net.Conn, error) {
 }
 
 func (d *dialer) DialLocalConn(network, addr string) (net.Conn, error) {
-	sshAddr := d.host.Address + ":22"
-	// Build SSH client configuration
-	cfg, err := makeSSHConfig(d.host.User, d.signer)
-	if err != nil {
-		return nil, fmt.Errorf("Error configuring SSH: %v", err)
-	}
-	// Establish connection with SSH server
-	conn, err := ssh.Dial("tcp", sshAddr, cfg)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to dial ssh using address [%s]: %v", sshAddr, err)
-	}
-	remote, err := conn.Dial(network, addr)
+	remote, err := d.conn.Dial(network, addr, d.connect)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to dial to Local Port [%d] on host [%s]: %v", d.host.LocalConnPort, d.host.Address, err)
 	}
 	return remote, err
 }
 
+func (d *dialer) connect() (*ssh.Client, error) {
+	return d.host.newSSHClient(d.signers)
+}
+
+// getSSHConnection returns the SSH connection of the host from the SSH pool of the cluster
+func (h *Host) getSSHConnection() *sshConnection {
+	return h.SSHPool.getSSHConnection(sshConnectionName(h.User, h.sshAddr(), h.Bastion))
+}
+
 func (h *Host) newHTTPClient(dialerFactory DialerFactory) (*http.Client, error) {
 	var factory DialerFactory
 
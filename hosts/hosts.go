@@ -3,6 +3,7 @@ package hosts
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
@@ -25,6 +26,10 @@ type Host struct {
 	ToAddEtcdMember     bool
 	ExistingEtcdCluster bool
 	SavedKeyPhrase      string
+	KnownHosts          *KnownHosts
+	Bastion             *Bastion
+	SSHOptions          SSHOptions
+	SSHPool             *SSHPool
 	ToAddLabels         map[string]string
 	ToDelLabels         map[string]string
 	ToAddTaints         []string
@@ -116,7 +121,7 @@ func (h *Host) CleanUp(ctx context.Context, toCleanPaths []string, cleanerImage
 	return nil
 }
 
-func DeleteNode(ctx context.Context, toDeleteHost *Host, kubeClient *kubernetes.Clientset, hasAnotherRole bool) error {
+func DeleteNode(ctx context.Context, toDeleteHost *Host, kubeClient *kubernetes.Clientset, hasAnotherRole bool, drainConfig v3.NodeDrainConfig, skipDrain bool) error {
 	if hasAnotherRole {
 		log.Infof(ctx, "[hosts] host [%s] has another role, skipping delete from kubernetes cluster", toDeleteHost.Address)
 		return nil
@@ -133,6 +138,14 @@ func DeleteNode(ctx context.Context, toDeleteHost *Host, kubeClient *kubernetes.
 	if err := k8s.CordonUncordon(kubeClient, toDeleteHost.HostnameOverride, true); err != nil {
 		return err
 	}
+	if skipDrain {
+		log.Warnf(ctx, "[hosts] Skipping drain of host [%s]", toDeleteHost.Address)
+	} else {
+		log.Infof(ctx, "[hosts] Draining host [%s]", toDeleteHost.Address)
+		if err := k8s.DrainNode(kubeClient, toDeleteHost.HostnameOverride, drainConfig.GracePeriod, time.Duration(drainConfig.Timeout)*time.Second); err != nil {
+			return err
+		}
+	}
 	log.Infof(ctx, "[hosts] Deleting host [%s] from the cluster", toDeleteHost.Address)
 	if err := k8s.DeleteNode(kubeClient, toDeleteHost.HostnameOverride); err != nil {
 		return err
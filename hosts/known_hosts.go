@@ -0,0 +1,313 @@
+package hosts
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	StrictHostKeyChecking          = "strict"
+	TrustOnFirstUseHostKeyChecking = "trust-on-first-use"
+	InsecureHostKeyChecking        = "insecure"
+
+	hostKeyVerificationFailed = "Host key verification failed"
+
+	// the markers are parsed without the leading @
+	knownHostsRevokedMarker = "revoked"
+	knownHostsHashPrefix    = "|1|"
+)
+
+// KnownHosts verifies the SSH host keys against the ssh_host_key of the hosts, the known_hosts files and the host keys
+// recorded in the cluster state. In trust-on-first-use mode the keys of unknown hosts are accepted and recorded
+type KnownHosts struct {
+	mode     string
+	entries  []knownHostsEntry
+	recorded map[string]string
+	newKeys  map[string]string
+	lock     sync.Mutex
+}
+
+type knownHostsEntry struct {
+	marker   string
+	patterns []string
+	key      ssh.PublicKey
+}
+
+// NewKnownHosts loads the known_hosts files, the files that don't exist are skipped. The recorded keys are indexed by
+// known_hosts address and use the authorized_keys format
+func NewKnownHosts(mode string, knownHostsPaths []string, recordedKeys map[string]string) (*KnownHosts, error) {
+	k := &KnownHosts{
+		mode:     mode,
+		recorded: map[string]string{},
+		newKeys:  map[string]string{},
+	}
+	for address, key := range recordedKeys {
+		k.recorded[address] = key
+	}
+	for _, knownHostsPath := range knownHostsPaths {
+		entries, err := readKnownHostsFile(expandPath(knownHostsPath))
+		if err != nil {
+			return nil, err
+		}
+		k.entries = append(k.entries, entries...)
+	}
+	return k, nil
+}
+
+// HostKeys returns all the host keys recorded in the cluster state, including the ones trusted on first use
+func (k *KnownHosts) HostKeys() map[string]string {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	hostKeys := map[string]string{}
+	for address, key := range k.recorded {
+		hostKeys[address] = key
+	}
+	return hostKeys
+}
+
+// NewHostKeys returns the host keys trusted on first use
+func (k *KnownHosts) NewHostKeys() map[string]string {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	newKeys := map[string]string{}
+	for address, key := range k.newKeys {
+		newKeys[address] = key
+	}
+	return newKeys
+}
+
+func (k *KnownHosts) checkHostKey(h *Host, sshAddr string, key ssh.PublicKey) error {
+	address := knownHostsAddress(sshAddr)
+	fingerprint := ssh.FingerprintSHA256(key)
+	knownKeys, err := k.getKnownKeys(h, address)
+	if err != nil {
+		return err
+	}
+	if err := k.checkRevoked(address, key); err != nil {
+		return err
+	}
+	for _, knownKey := range knownKeys {
+		if bytes.Equal(knownKey.Marshal(), key.Marshal()) {
+			return nil
+		}
+	}
+	if len(knownKeys) > 0 {
+		return fmt.Errorf("%s for host [%s]: %s key with fingerprint [%s] doesn't match the known host keys, the host may have been reinstalled or the connection may be intercepted",
+			hostKeyVerificationFailed, h.Address, key.Type(), fingerprint)
+	}
+	if k.mode != TrustOnFirstUseHostKeyChecking {
+		return fmt.Errorf("%s for host [%s]: %s key with fingerprint [%s] is unknown, add it to the known_hosts file or set ssh_host_key for the host",
+			hostKeyVerificationFailed, h.Address, key.Type(), fingerprint)
+	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	k.recorded[address] = authorizedKey
+	k.newKeys[address] = authorizedKey
+	logrus.Debugf("[ssh] Trusting %s host key of host [%s] on first use, fingerprint [%s]", key.Type(), h.Address, fingerprint)
+	return nil
+}
+
+// getKnownKeys returns the keys trusted for a host, a host with ssh_host_key only trusts that key
+func (k *KnownHosts) getKnownKeys(h *Host, address string) ([]ssh.PublicKey, error) {
+	if len(h.SSHHostKey) > 0 {
+		hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(h.SSHHostKey))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse ssh_host_key of host [%s]: %v", h.Address, err)
+		}
+		return []ssh.PublicKey{hostKey}, nil
+	}
+	knownKeys := []ssh.PublicKey{}
+	for _, entry := range k.entries {
+		// host certificate authorities aren't supported, only the host keys are trusted
+		if len(entry.marker) == 0 && entry.matches(address) {
+			knownKeys = append(knownKeys, entry.key)
+		}
+	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if recordedKey, ok := k.recorded[address]; ok {
+		hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(recordedKey))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse host key of host [%s] recorded in the cluster state: %v", h.Address, err)
+		}
+		knownKeys = append(knownKeys, hostKey)
+	}
+	return knownKeys, nil
+}
+
+func (k *KnownHosts) checkRevoked(address string, key ssh.PublicKey) error {
+	for _, entry := range k.entries {
+		if entry.marker == knownHostsRevokedMarker && entry.matches(address) && bytes.Equal(entry.key.Marshal(), key.Marshal()) {
+			return fmt.Errorf("%s for host [%s]: %s key with fingerprint [%s] is revoked",
+				hostKeyVerificationFailed, address, key.Type(), ssh.FingerprintSHA256(key))
+		}
+	}
+	return nil
+}
+
+// hostKeyAlgorithms returns the types of the known keys of a host, so the host presents a key that can be verified
+func (k *KnownHosts) hostKeyAlgorithms(h *Host, sshAddr string) []string {
+	knownKeys, err := k.getKnownKeys(h, knownHostsAddress(sshAddr))
+	if err != nil {
+		return nil
+	}
+	var algorithms []string
+	for _, knownKey := range knownKeys {
+		if !isStringInSlice(knownKey.Type(), algorithms) {
+			algorithms = append(algorithms, knownKey.Type())
+		}
+	}
+	return algorithms
+}
+
+func (h *Host) hostKeyCallback() ssh.HostKeyCallback {
+	if h.KnownHosts == nil || h.KnownHosts.mode == InsecureHostKeyChecking {
+		return ssh.InsecureIgnoreHostKey()
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return h.KnownHosts.checkHostKey(h, hostname, key)
+	}
+}
+
+func (h *Host) hostKeyAlgorithms(sshAddr string) []string {
+	if h.KnownHosts == nil || h.KnownHosts.mode == InsecureHostKeyChecking {
+		return nil
+	}
+	return h.KnownHosts.hostKeyAlgorithms(h, sshAddr)
+}
+
+func (e knownHostsEntry) matches(address string) bool {
+	matched := false
+	for _, pattern := range e.patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		if negated {
+			pattern = pattern[1:]
+		}
+		if !matchKnownHostsPattern(pattern, address) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+func matchKnownHostsPattern(pattern, address string) bool {
+	if strings.HasPrefix(pattern, knownHostsHashPrefix) {
+		parts := strings.Split(pattern[len(knownHostsHashPrefix):], "|")
+		if len(parts) != 2 {
+			return false
+		}
+		salt, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return false
+		}
+		hash, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha1.New, salt)
+		mac.Write([]byte(address))
+		return hmac.Equal(mac.Sum(nil), hash)
+	}
+	return matchWildcard(pattern, address)
+}
+
+// matchWildcard matches the * and ? wildcards of the known_hosts patterns
+func matchWildcard(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchWildcard(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+	return len(s) == 0
+}
+
+// knownHostsAddress returns the address of an SSH server as written in the known_hosts files
+func knownHostsAddress(sshAddr string) string {
+	address, port, err := net.SplitHostPort(sshAddr)
+	if err != nil {
+		return sshAddr
+	}
+	if port == "22" {
+		return address
+	}
+	return "[" + address + "]:" + port
+}
+
+func readKnownHostsFile(path string) ([]knownHostsEntry, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Failed to read known hosts file [%s]: %v", path, err)
+	}
+	entries := []knownHostsEntry{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		marker, patterns, key, _, _, err := ssh.ParseKnownHosts(scanner.Bytes())
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			logrus.Debugf("[ssh] Skipping invalid line of known hosts file [%s]: %v", path, err)
+			continue
+		}
+		entries = append(entries, knownHostsEntry{
+			marker:   marker,
+			patterns: patterns,
+			key:      key,
+		})
+	}
+	return entries, scanner.Err()
+}
+
+func expandPath(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(os.Getenv("HOME"), path[2:])
+	}
+	return path
+}
+
+func isStringInSlice(entry string, list []string) bool {
+	for _, item := range list {
+		if item == entry {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,298 @@
+package hosts
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	TestHostAddress      = "10.0.0.1"
+	TestHostSSHAddress   = "10.0.0.1:22"
+	TestHostCustomPort   = "10.0.0.1:2222"
+	TestOtherHostAddress = "10.0.0.2"
+)
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		matches bool
+	}{
+		{"10.0.0.1", "10.0.0.1", true},
+		{"10.0.0.1", "10.0.0.10", false},
+		{"10.0.0.*", "10.0.0.10", true},
+		{"10.0.0.*", "10.0.1.10", false},
+		{"*", "", true},
+		{"*.example.com", "node.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"10.0.0.?", "10.0.0.1", true},
+		{"10.0.0.?", "10.0.0.10", false},
+		{"10.0.0.?", "10.0.0.", false},
+		{"node-*-?.example.com", "node-a-b-1.example.com", true},
+		{"[10.0.0.1]:*", "[10.0.0.1]:2222", true},
+		{"", "", true},
+		{"", "10.0.0.1", false},
+	}
+	for _, test := range tests {
+		assertEqual(t, matchWildcard(test.pattern, test.s), test.matches,
+			fmt.Sprintf("Failed to match pattern [%s] against [%s], expected [%v]", test.pattern, test.s, test.matches))
+	}
+}
+
+func TestKnownHostsEntryMatches(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		address  string
+		matches  bool
+	}{
+		{[]string{TestHostAddress}, TestHostAddress, true},
+		{[]string{TestOtherHostAddress, TestHostAddress}, TestHostAddress, true},
+		{[]string{TestOtherHostAddress}, TestHostAddress, false},
+		{[]string{getTestHashedPattern(TestHostAddress)}, TestHostAddress, true},
+		{[]string{getTestHashedPattern(TestHostAddress)}, TestOtherHostAddress, false},
+		{[]string{getTestHashedPattern("[10.0.0.1]:2222")}, "[10.0.0.1]:2222", true},
+		{[]string{"|1|invalid"}, TestHostAddress, false},
+		{[]string{"|1|!!!|!!!"}, TestHostAddress, false},
+		{[]string{"10.0.0.*", "!" + TestHostAddress}, TestHostAddress, false},
+		{[]string{"!" + TestHostAddress, "10.0.0.*"}, TestHostAddress, false},
+		{[]string{"10.0.0.*", "!" + TestHostAddress}, TestOtherHostAddress, true},
+		// a negated pattern alone doesn't match any host
+		{[]string{"!" + TestHostAddress}, TestOtherHostAddress, false},
+	}
+	for _, test := range tests {
+		entry := knownHostsEntry{patterns: test.patterns}
+		assertEqual(t, entry.matches(test.address), test.matches,
+			fmt.Sprintf("Failed to match patterns %v against [%s], expected [%v]", test.patterns, test.address, test.matches))
+	}
+}
+
+func TestKnownHostsAddress(t *testing.T) {
+	assertEqual(t, knownHostsAddress(TestHostSSHAddress), TestHostAddress, "Failed to omit the default SSH port")
+	assertEqual(t, knownHostsAddress(TestHostCustomPort), "[10.0.0.1]:2222", "Failed to bracket the address with a custom SSH port")
+	assertEqual(t, knownHostsAddress(TestHostAddress), TestHostAddress, "Failed to keep the address without port")
+}
+
+func TestCheckHostKey(t *testing.T) {
+	hostKey := getTestHostKey(t)
+	otherKey := getTestHostKey(t)
+	dir, err := ioutil.TempDir("", "rke-known-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name         string
+		mode         string
+		knownHosts   []string
+		recordedKeys map[string]string
+		sshHostKey   string
+		sshAddr      string
+		key          ssh.PublicKey
+		valid        bool
+		recorded     bool
+	}{
+		{
+			name:       "known host",
+			mode:       StrictHostKeyChecking,
+			knownHosts: []string{getTestKnownHostsLine("", TestHostAddress, hostKey)},
+			sshAddr:    TestHostSSHAddress,
+			key:        hostKey,
+			valid:      true,
+		},
+		{
+			name:       "known host with custom port",
+			mode:       StrictHostKeyChecking,
+			knownHosts: []string{getTestKnownHostsLine("", "[10.0.0.1]:2222", hostKey)},
+			sshAddr:    TestHostCustomPort,
+			key:        hostKey,
+			valid:      true,
+		},
+		{
+			name:       "known host on another port",
+			mode:       StrictHostKeyChecking,
+			knownHosts: []string{getTestKnownHostsLine("", TestHostAddress, hostKey)},
+			sshAddr:    TestHostCustomPort,
+			key:        hostKey,
+		},
+		{
+			name:       "hashed known host",
+			mode:       StrictHostKeyChecking,
+			knownHosts: []string{getTestKnownHostsLine("", getTestHashedPattern(TestHostAddress), hostKey)},
+			sshAddr:    TestHostSSHAddress,
+			key:        hostKey,
+			valid:      true,
+		},
+		{
+			name:       "wildcard known host",
+			mode:       StrictHostKeyChecking,
+			knownHosts: []string{getTestKnownHostsLine("", "10.0.0.*", hostKey)},
+			sshAddr:    TestHostSSHAddress,
+			key:        hostKey,
+			valid:      true,
+		},
+		{
+			name:       "negated known host",
+			mode:       StrictHostKeyChecking,
+			knownHosts: []string{getTestKnownHostsLine("", "10.0.0.*,!"+TestHostAddress, hostKey)},
+			sshAddr:    TestHostSSHAddress,
+			key:        hostKey,
+		},
+		{
+			name:       "changed host key",
+			mode:       TrustOnFirstUseHostKeyChecking,
+			knownHosts: []string{getTestKnownHostsLine("", TestHostAddress, otherKey)},
+			sshAddr:    TestHostSSHAddress,
+			key:        hostKey,
+		},
+		{
+			name:         "changed recorded host key",
+			mode:         TrustOnFirstUseHostKeyChecking,
+			recordedKeys: map[string]string{TestHostAddress: getTestAuthorizedKey(otherKey)},
+			sshAddr:      TestHostSSHAddress,
+			key:          hostKey,
+		},
+		{
+			name:         "recorded host key",
+			mode:         StrictHostKeyChecking,
+			recordedKeys: map[string]string{TestHostAddress: getTestAuthorizedKey(hostKey)},
+			sshAddr:      TestHostSSHAddress,
+			key:          hostKey,
+			valid:        true,
+		},
+		{
+			name: "revoked host key",
+			mode: TrustOnFirstUseHostKeyChecking,
+			knownHosts: []string{
+				getTestKnownHostsLine("", TestHostAddress, hostKey),
+				getTestKnownHostsLine(knownHostsRevokedMarker, "*", hostKey),
+			},
+			sshAddr: TestHostSSHAddress,
+			key:     hostKey,
+		},
+		{
+			name: "revoked key of another host",
+			mode: StrictHostKeyChecking,
+			knownHosts: []string{
+				getTestKnownHostsLine("", TestHostAddress, hostKey),
+				getTestKnownHostsLine(knownHostsRevokedMarker, TestOtherHostAddress, hostKey),
+			},
+			sshAddr: TestHostSSHAddress,
+			key:     hostKey,
+			valid:   true,
+		},
+		{
+			name:    "unknown host in strict mode",
+			mode:    StrictHostKeyChecking,
+			sshAddr: TestHostSSHAddress,
+			key:     hostKey,
+		},
+		{
+			name:     "unknown host trusted on first use",
+			mode:     TrustOnFirstUseHostKeyChecking,
+			sshAddr:  TestHostSSHAddress,
+			key:      hostKey,
+			valid:    true,
+			recorded: true,
+		},
+		{
+			name:       "ssh_host_key of the host",
+			mode:       StrictHostKeyChecking,
+			sshHostKey: getTestAuthorizedKey(hostKey),
+			sshAddr:    TestHostSSHAddress,
+			key:        hostKey,
+			valid:      true,
+		},
+		{
+			name:       "ssh_host_key takes precedence over the known hosts",
+			mode:       TrustOnFirstUseHostKeyChecking,
+			knownHosts: []string{getTestKnownHostsLine("", TestHostAddress, hostKey)},
+			sshHostKey: getTestAuthorizedKey(otherKey),
+			sshAddr:    TestHostSSHAddress,
+			key:        hostKey,
+		},
+		{
+			name:       "invalid ssh_host_key",
+			mode:       TrustOnFirstUseHostKeyChecking,
+			sshHostKey: "ssh-rsa invalid",
+			sshAddr:    TestHostSSHAddress,
+			key:        hostKey,
+		},
+	}
+	for i, test := range tests {
+		knownHostsPath := filepath.Join(dir, fmt.Sprintf("known_hosts_%d", i))
+		if err := ioutil.WriteFile(knownHostsPath, []byte(strings.Join(test.knownHosts, "\n")), 0600); err != nil {
+			t.Fatal(err)
+		}
+		knownHosts, err := NewKnownHosts(test.mode, []string{knownHostsPath, filepath.Join(dir, "missing")}, test.recordedKeys)
+		if err != nil {
+			t.Fatalf("Failed to load known hosts of test [%s]: %v", test.name, err)
+		}
+		host := &Host{RKEConfigNode: v3.RKEConfigNode{Address: TestHostAddress, SSHHostKey: test.sshHostKey}}
+		err = knownHosts.checkHostKey(host, test.sshAddr, test.key)
+		assertEqual(t, err == nil, test.valid, fmt.Sprintf("Failed to verify host key of test [%s]: %v", test.name, err))
+		_, recorded := knownHosts.NewHostKeys()[knownHostsAddress(test.sshAddr)]
+		assertEqual(t, recorded, test.recorded, fmt.Sprintf("Failed to verify recorded host key of test [%s]", test.name))
+		if test.recorded {
+			assertEqual(t, knownHosts.HostKeys()[knownHostsAddress(test.sshAddr)], getTestAuthorizedKey(test.key),
+				fmt.Sprintf("Failed to record host key of test [%s]", test.name))
+			// the key trusted on first use is verified on the next connection
+			err = knownHosts.checkHostKey(host, test.sshAddr, otherKey)
+			assertEqual(t, err == nil, false, fmt.Sprintf("Failed to reject changed host key of test [%s]", test.name))
+		}
+	}
+}
+
+func getTestHostKey(t *testing.T) ssh.PublicKey {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hostKey
+}
+
+func getTestAuthorizedKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func getTestKnownHostsLine(marker, patterns string, key ssh.PublicKey) string {
+	line := patterns + " " + getTestAuthorizedKey(key)
+	if len(marker) > 0 {
+		line = "@" + marker + " " + line
+	}
+	return line
+}
+
+func getTestHashedPattern(address string) string {
+	salt := []byte("rke-known-hosts-salt")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(address))
+	return knownHostsHashPrefix + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func assertEqual(t *testing.T, a interface{}, b interface{}, message string) {
+	if a == b {
+		return
+	}
+	if len(message) == 0 {
+		message = fmt.Sprintf("%v != %v", a, b)
+	}
+	t.Fatal(message)
+}
@@ -0,0 +1,153 @@
+package hosts
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	SSHAuthError     = "auth"
+	SSHNetworkError  = "network"
+	SSHHostKeyError  = "host key"
+	SSHProtocolError = "protocol"
+
+	sshHandshakeTimedOut = "SSH handshake timed out"
+)
+
+var sshErrorHints = map[string]string{
+	SSHAuthError:     "check the SSH user and the SSH key, ssh-agent or certificate of the host",
+	SSHNetworkError:  "check that the host is reachable and that its SSH server listens on the SSH port",
+	SSHHostKeyError:  "check the known_hosts file and the ssh_host_key of the host",
+	SSHProtocolError: "check that the SSH port of the host is an SSH server supporting the algorithms of RKE",
+}
+
+// sshNetworkErrors are the handshake errors caused by a connection lost or dropped, like the connections dropped by
+// the MaxStartups limit of sshd. The handshake errors are only available as strings
+var sshNetworkErrors = []string{
+	"EOF",
+	"connection reset by peer",
+	"broken pipe",
+	"i/o timeout",
+	sshHandshakeTimedOut,
+}
+
+// SSHOptions are the timeout and the retries of the SSH connections, only network errors are retried
+type SSHOptions struct {
+	Timeout         time.Duration
+	Retries         int
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+}
+
+// SSHError is an SSH connection error classified as an auth, network, host key or protocol error
+type SSHError struct {
+	Type    string
+	Address string
+	Err     error
+}
+
+func (e *SSHError) Error() string {
+	return fmt.Sprintf("Failed to dial ssh using address [%s]: %s error: %v, %s", e.Address, e.Type, e.Err, sshErrorHints[e.Type])
+}
+
+// newSSHClient connects to the SSH server of the host, through its bastion host if set. Network errors are retried
+// with an exponential backoff
+func (h *Host) newSSHClient(signers []ssh.Signer) (*ssh.Client, error) {
+	sshAddr := h.sshAddr()
+	// Build SSH client configuration
+	cfg, err := makeSSHConfig(h, sshAddr, signers)
+	if err != nil {
+		return nil, fmt.Errorf("Error configuring SSH: %v", err)
+	}
+	backoff := h.SSHOptions.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		client, err := h.dialSSH(sshAddr, cfg)
+		if err == nil {
+			return client, nil
+		}
+		// the errors of the bastion host connection are already retried by the bastion host
+		sshErr, ok := err.(*SSHError)
+		if !ok || sshErr.Type != SSHNetworkError || sshErr.Address != sshAddr || attempt >= h.SSHOptions.Retries {
+			return nil, err
+		}
+		logrus.Warnf("[ssh] Failed to connect to host [%s], retrying in %v (%d/%d): %v", h.Address, backoff, attempt+1, h.SSHOptions.Retries, sshErr.Err)
+		time.Sleep(backoff)
+		backoff = getNextSSHRetryBackoff(backoff, h.SSHOptions.MaxRetryBackoff)
+	}
+}
+
+// getNextSSHRetryBackoff doubles the backoff up to the maximum backoff, a maximum backoff of 0 doesn't limit it
+func getNextSSHRetryBackoff(backoff, maxBackoff time.Duration) time.Duration {
+	if backoff *= 2; maxBackoff > 0 && backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+func (h *Host) dialSSH(sshAddr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	var conn net.Conn
+	var err error
+	if h.Bastion == nil {
+		// Establish connection with SSH server
+		if conn, err = net.DialTimeout("tcp", sshAddr, h.SSHOptions.Timeout); err != nil {
+			return nil, &SSHError{Type: SSHNetworkError, Address: sshAddr, Err: err}
+		}
+	} else {
+		if conn, err = h.Bastion.Dial("tcp", sshAddr); err != nil {
+			if _, ok := err.(*SSHError); ok {
+				return nil, err
+			}
+			return nil, &SSHError{Type: SSHNetworkError, Address: sshAddr, Err: err}
+		}
+	}
+	// the handshake is aborted by closing the connection, since the connections through a bastion host have no deadlines
+	var timer *time.Timer
+	if h.SSHOptions.Timeout > 0 {
+		timer = time.AfterFunc(h.SSHOptions.Timeout, func() {
+			conn.Close()
+		})
+	}
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, sshAddr, cfg)
+	if timer != nil && !timer.Stop() {
+		if err == nil {
+			clientConn.Close()
+		}
+		err = fmt.Errorf("%s after %v", sshHandshakeTimedOut, h.SSHOptions.Timeout)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, &SSHError{Type: getSSHErrorType(err), Address: sshAddr, Err: err}
+	}
+	return ssh.NewClient(clientConn, chans, reqs), nil
+}
+
+// getSSHErrorType classifies the handshake errors, the errors that aren't known network errors, like a protocol version
+// or algorithm mismatch, are protocol errors and aren't retried
+func getSSHErrorType(err error) string {
+	message := err.Error()
+	switch {
+	case strings.Contains(message, hostKeyVerificationFailed):
+		return SSHHostKeyError
+	case strings.Contains(message, "unable to authenticate"):
+		return SSHAuthError
+	}
+	for _, networkError := range sshNetworkErrors {
+		if strings.Contains(message, networkError) {
+			return SSHNetworkError
+		}
+	}
+	return SSHProtocolError
+}
+
+func (h *Host) sshAddr() string {
+	port := h.Port
+	if len(port) == 0 {
+		port = DefaultSSHPort
+	}
+	return net.JoinHostPort(h.Address, port)
+}
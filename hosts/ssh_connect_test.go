@@ -0,0 +1,132 @@
+package hosts
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+	"golang.org/x/crypto/ssh"
+)
+
+const TestRetryBackoff = time.Millisecond
+
+func TestGetSSHErrorType(t *testing.T) {
+	tests := []struct {
+		err       error
+		errorType string
+	}{
+		{fmt.Errorf("ssh: handshake failed: %v", io.EOF), SSHNetworkError},
+		{fmt.Errorf("ssh: handshake failed: %v", io.ErrUnexpectedEOF), SSHNetworkError},
+		{fmt.Errorf("ssh: handshake failed: read tcp 10.0.0.10:40000->10.0.0.1:22: read: connection reset by peer"), SSHNetworkError},
+		{fmt.Errorf("ssh: handshake failed: write tcp 10.0.0.10:40000->10.0.0.1:22: write: broken pipe"), SSHNetworkError},
+		{fmt.Errorf("ssh: handshake failed: read tcp 10.0.0.10:40000->10.0.0.1:22: i/o timeout"), SSHNetworkError},
+		{fmt.Errorf("%s after %v", sshHandshakeTimedOut, time.Second), SSHNetworkError},
+		{fmt.Errorf("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none publickey], no supported methods remain"), SSHAuthError},
+		{fmt.Errorf("ssh: handshake failed: %s for host [10.0.0.1]: ssh-ed25519 key with fingerprint [SHA256:test] is revoked", hostKeyVerificationFailed), SSHHostKeyError},
+		{fmt.Errorf("ssh: handshake failed: ssh: no common algorithm for client to server cipher; client offered: [aes128-ctr], server offered: [arcfour]"), SSHProtocolError},
+		{fmt.Errorf("ssh: handshake failed: ssh: overflow reading version string"), SSHProtocolError},
+		{fmt.Errorf("ssh: handshake failed: ssh: disconnect, reason 2: Protocol major versions differ."), SSHProtocolError},
+		{fmt.Errorf("ssh: handshake failed: ssh: unexpected message type 3 (expected 31)"), SSHProtocolError},
+	}
+	for _, test := range tests {
+		assertEqual(t, getSSHErrorType(test.err), test.errorType, fmt.Sprintf("Failed to classify SSH error [%v] as [%s] error", test.err, test.errorType))
+	}
+}
+
+func TestGetNextSSHRetryBackoff(t *testing.T) {
+	tests := []struct {
+		maxBackoff time.Duration
+		backoffs   []time.Duration
+	}{
+		{30 * time.Second, []time.Duration{4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second}},
+		{0, []time.Duration{4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, 64 * time.Second}},
+		{time.Second, []time.Duration{time.Second, time.Second}},
+	}
+	for _, test := range tests {
+		backoff := 2 * time.Second
+		for i, expectedBackoff := range test.backoffs {
+			backoff = getNextSSHRetryBackoff(backoff, test.maxBackoff)
+			assertEqual(t, backoff, expectedBackoff, fmt.Sprintf("Failed to verify backoff of retry [%d] with maximum backoff [%v]: %v", i+1, test.maxBackoff, backoff))
+		}
+	}
+}
+
+func TestNewSSHClientRetries(t *testing.T) {
+	// a server dropping the connections during the handshake fails with network errors
+	droppingListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer droppingListener.Close()
+	dropped := make(chan struct{}, 10)
+	go func() {
+		for {
+			conn, err := droppingListener.Accept()
+			if err != nil {
+				return
+			}
+			// counted before the connection is dropped, so the attempt is counted when the client fails
+			dropped <- struct{}{}
+			conn.Close()
+		}
+	}()
+	_, droppingPort, _ := net.SplitHostPort(droppingListener.Addr().String())
+
+	// a server without common ciphers fails with a protocol error
+	mismatchServer := newTestSSHServer(t, &ssh.ServerConfig{Config: ssh.Config{Ciphers: []string{"arcfour"}}}, true)
+	defer mismatchServer.close()
+
+	tests := []struct {
+		name             string
+		port             string
+		retries          int
+		errorType        string
+		expectedAttempts int
+	}{
+		{"network error", droppingPort, 2, SSHNetworkError, 3},
+		{"network error without retries", droppingPort, 0, SSHNetworkError, 1},
+		{"protocol error", mismatchServer.port(), 2, SSHProtocolError, 1},
+	}
+	signers := []ssh.Signer{getTestSigner(t)}
+	for _, test := range tests {
+		host := &Host{
+			RKEConfigNode: v3.RKEConfigNode{Address: "127.0.0.1", Port: test.port, User: "rke"},
+			SSHOptions: SSHOptions{
+				Timeout:         time.Second,
+				Retries:         test.retries,
+				RetryBackoff:    TestRetryBackoff,
+				MaxRetryBackoff: TestRetryBackoff,
+			},
+		}
+		acceptsBefore := mismatchServer.getAccepts()
+		_, err := host.newSSHClient(signers)
+		sshErr, ok := err.(*SSHError)
+		assertEqual(t, ok && sshErr.Type == test.errorType, true, fmt.Sprintf("Failed to return [%s] error for [%s]: %v", test.errorType, test.name, err))
+		attempts := mismatchServer.getAccepts() - acceptsBefore
+		if test.port == droppingPort {
+			attempts = len(dropped)
+			for len(dropped) > 0 {
+				<-dropped
+			}
+		}
+		assertEqual(t, attempts, test.expectedAttempts, fmt.Sprintf("Failed to verify connection attempts for [%s]: %d", test.name, attempts))
+	}
+}
+
+func getTestSigner(t *testing.T) ssh.Signer {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
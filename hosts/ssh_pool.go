@@ -0,0 +1,178 @@
+package hosts
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sshKeepAliveInterval = 15 * time.Second
+	sshKeepAliveTimeout  = 30 * time.Second
+	sshKeepAliveRequest  = "keepalive@openssh.com"
+)
+
+// SSHPool keeps the SSH connections of the hosts of a cluster, so the dialers of a host share one SSH client
+type SSHPool struct {
+	connections       map[string]*sshConnection
+	keepAliveInterval time.Duration
+	keepAliveTimeout  time.Duration
+	lock              sync.Mutex
+}
+
+// sshConnection is an SSH client shared by all the dialers of a host, the Docker socket and local port connections
+// are multiplexed over it. The client is checked with keepalives and reconnected when it dies
+type sshConnection struct {
+	name              string
+	client            *ssh.Client
+	keepAliveInterval time.Duration
+	keepAliveTimeout  time.Duration
+	lock              sync.Mutex
+}
+
+func NewSSHPool() *SSHPool {
+	return &SSHPool{
+		connections:       map[string]*sshConnection{},
+		keepAliveInterval: sshKeepAliveInterval,
+		keepAliveTimeout:  sshKeepAliveTimeout,
+	}
+}
+
+// getSSHConnection returns the pooled SSH connection of a host, without a pool the connection isn't shared
+func (p *SSHPool) getSSHConnection(name string) *sshConnection {
+	if p == nil {
+		return &sshConnection{
+			name:              name,
+			keepAliveInterval: sshKeepAliveInterval,
+			keepAliveTimeout:  sshKeepAliveTimeout,
+		}
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	conn, ok := p.connections[name]
+	if !ok {
+		conn = &sshConnection{
+			name:              name,
+			keepAliveInterval: p.keepAliveInterval,
+			keepAliveTimeout:  p.keepAliveTimeout,
+		}
+		p.connections[name] = conn
+	}
+	return conn
+}
+
+// Close closes the SSH clients of the pool, a connection used again afterwards opens a new client
+func (p *SSHPool) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, conn := range p.connections {
+		conn.close()
+	}
+}
+
+// Dial opens a connection to the address from the host, it reconnects once if the SSH client died since the last keepalive.
+// connect opens the SSH client when the connection has no live client, so it uses the credentials of the caller
+func (c *sshConnection) Dial(network, address string, connect func() (*ssh.Client, error)) (net.Conn, error) {
+	client, err := c.getClient(connect)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial(network, address)
+	if err == nil {
+		return conn, nil
+	}
+	if _, ok := err.(*ssh.OpenChannelError); ok {
+		// the SSH server is alive but refused the connection
+		return nil, err
+	}
+	logrus.Debugf("[ssh] Reconnecting SSH client of [%s]: %v", c.name, err)
+	c.reset(client)
+	if client, err = c.getClient(connect); err != nil {
+		return nil, err
+	}
+	return client.Dial(network, address)
+}
+
+func (c *sshConnection) getClient(connect func() (*ssh.Client, error)) (*ssh.Client, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.client != nil {
+		return c.client, nil
+	}
+	client, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	c.client = client
+	go c.keepAlive(client)
+	go func() {
+		client.Wait()
+		c.reset(client)
+	}()
+	return client, nil
+}
+
+// keepAlive sends keepalive requests until the client is closed, a client that doesn't answer in time is closed
+func (c *sshConnection) keepAlive(client *ssh.Client) {
+	ticker := time.NewTicker(c.keepAliveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !c.isClient(client) {
+			return
+		}
+		errCh := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest(sshKeepAliveRequest, true, nil)
+			errCh <- err
+		}()
+		select {
+		case err := <-errCh:
+			if err != nil {
+				logrus.Debugf("[ssh] Keepalive failed for SSH client of [%s]: %v", c.name, err)
+				c.reset(client)
+				return
+			}
+		case <-time.After(c.keepAliveTimeout):
+			logrus.Debugf("[ssh] Keepalive timed out for SSH client of [%s]", c.name)
+			c.reset(client)
+			return
+		}
+	}
+}
+
+func (c *sshConnection) isClient(client *ssh.Client) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.client == client
+}
+
+// reset closes the client and removes it from the connection, unless it was already replaced by a new client
+func (c *sshConnection) reset(client *ssh.Client) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	client.Close()
+	if c.client == client {
+		c.client = nil
+	}
+}
+
+func (c *sshConnection) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.client != nil {
+		c.client.Close()
+		c.client = nil
+	}
+}
+
+func sshConnectionName(user, sshAddr string, bastion *Bastion) string {
+	name := fmt.Sprintf("%s@%s", user, sshAddr)
+	if bastion != nil {
+		name = fmt.Sprintf("%s via %s", name, bastion.name())
+	}
+	return name
+}
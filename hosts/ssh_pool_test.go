@@ -0,0 +1,229 @@
+package hosts
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	TestSSHConnectionName = "rke@10.0.0.1:22"
+	TestSSHDialAddress    = "127.0.0.1:2379"
+	TestKeepAliveInterval = 20 * time.Millisecond
+	TestKeepAliveTimeout  = 50 * time.Millisecond
+)
+
+// testSSHServer accepts the direct-tcpip channels of the SSH clients, the keepalives are answered only with replyKeepAlive
+type testSSHServer struct {
+	listener       net.Listener
+	config         *ssh.ServerConfig
+	replyKeepAlive bool
+	conns          []net.Conn
+	accepts        int
+	connects       int
+	lock           sync.Mutex
+}
+
+// newTestSSHServer starts an SSH server without client authentication, a nil config uses the default algorithms
+func newTestSSHServer(t *testing.T, config *ssh.ServerConfig, replyKeepAlive bool) *testSSHServer {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config == nil {
+		config = &ssh.ServerConfig{}
+	}
+	config.NoClientAuth = true
+	s := &testSSHServer{
+		listener:       listener,
+		config:         config,
+		replyKeepAlive: replyKeepAlive,
+	}
+	s.config.AddHostKey(hostKey)
+	go s.serve()
+	return s
+}
+
+func (s *testSSHServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.lock.Lock()
+		s.conns = append(s.conns, conn)
+		s.accepts++
+		s.lock.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *testSSHServer) handle(conn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	if s.replyKeepAlive {
+		go ssh.DiscardRequests(reqs)
+	} else {
+		go func() {
+			// the requests are never answered, like a server that stopped responding
+			for range reqs {
+			}
+		}()
+	}
+	for newChannel := range chans {
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		channel.Close()
+	}
+}
+
+// connect opens a new SSH client to the server
+func (s *testSSHServer) connect() (*ssh.Client, error) {
+	s.lock.Lock()
+	s.connects++
+	s.lock.Unlock()
+	return ssh.Dial("tcp", s.listener.Addr().String(), &ssh.ClientConfig{
+		User:            "rke",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+}
+
+func (s *testSSHServer) getConnects() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.connects
+}
+
+func (s *testSSHServer) getAccepts() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.accepts
+}
+
+func (s *testSSHServer) port() string {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return port
+}
+
+// kill closes the connections of the SSH clients without closing the clients
+func (s *testSSHServer) kill() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testSSHServer) close() {
+	s.listener.Close()
+	s.kill()
+}
+
+func newTestSSHPool(keepAliveInterval time.Duration) *SSHPool {
+	sshPool := NewSSHPool()
+	sshPool.keepAliveInterval = keepAliveInterval
+	sshPool.keepAliveTimeout = TestKeepAliveTimeout
+	return sshPool
+}
+
+func dialTestSSHConnection(t *testing.T, conn *sshConnection, server *testSSHServer) {
+	remote, err := conn.Dial("tcp", TestSSHDialAddress, server.connect)
+	if err != nil {
+		t.Fatalf("Failed to dial through SSH connection: %v", err)
+	}
+	remote.Close()
+}
+
+func waitForClientReset(conn *sshConnection, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if conn.isClient(nil) {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestSSHConnectionReconnect(t *testing.T) {
+	server := newTestSSHServer(t, nil, true)
+	defer server.close()
+	sshPool := newTestSSHPool(time.Hour)
+	defer sshPool.Close()
+
+	conn := sshPool.getSSHConnection(TestSSHConnectionName)
+	dialTestSSHConnection(t, conn, server)
+	dialTestSSHConnection(t, sshPool.getSSHConnection(TestSSHConnectionName), server)
+	assertEqual(t, server.getConnects(), 1, "Failed to share the SSH client of the pooled connection")
+
+	// the SSH client dies, the next dial opens a new client
+	server.kill()
+	dialTestSSHConnection(t, conn, server)
+	assertEqual(t, server.getConnects(), 2, "Failed to reconnect the dead SSH client")
+	dialTestSSHConnection(t, conn, server)
+	assertEqual(t, server.getConnects(), 2, "Failed to reuse the reconnected SSH client")
+}
+
+func TestSSHConnectionKeepAlive(t *testing.T) {
+	server := newTestSSHServer(t, nil, true)
+	defer server.close()
+	sshPool := newTestSSHPool(TestKeepAliveInterval)
+	defer sshPool.Close()
+
+	conn := sshPool.getSSHConnection(TestSSHConnectionName)
+	dialTestSSHConnection(t, conn, server)
+	time.Sleep(5 * TestKeepAliveInterval)
+	assertEqual(t, conn.isClient(nil), false, "Failed to keep the SSH client that answers the keepalives")
+	dialTestSSHConnection(t, conn, server)
+	assertEqual(t, server.getConnects(), 1, "Failed to reuse the SSH client that answers the keepalives")
+
+	unresponsiveServer := newTestSSHServer(t, nil, false)
+	defer unresponsiveServer.close()
+	unresponsiveConn := sshPool.getSSHConnection("rke@10.0.0.2:22")
+	dialTestSSHConnection(t, unresponsiveConn, unresponsiveServer)
+	if !waitForClientReset(unresponsiveConn, time.Second) {
+		t.Fatal("Failed to reset the SSH client that doesn't answer the keepalives")
+	}
+	dialTestSSHConnection(t, unresponsiveConn, unresponsiveServer)
+	assertEqual(t, unresponsiveServer.getConnects(), 2, "Failed to reconnect the SSH client reset by the keepalive")
+}
+
+func TestSSHPoolClose(t *testing.T) {
+	server := newTestSSHServer(t, nil, true)
+	defer server.close()
+	sshPool := newTestSSHPool(time.Hour)
+	otherPool := newTestSSHPool(time.Hour)
+	defer otherPool.Close()
+
+	conn := sshPool.getSSHConnection(TestSSHConnectionName)
+	otherConn := otherPool.getSSHConnection(TestSSHConnectionName)
+	dialTestSSHConnection(t, conn, server)
+	dialTestSSHConnection(t, otherConn, server)
+	assertEqual(t, server.getConnects(), 2, "Failed to use a separate SSH client for each pool")
+
+	sshPool.Close()
+	assertEqual(t, conn.isClient(nil), true, "Failed to close the SSH client of the pool")
+	assertEqual(t, otherConn.isClient(nil), false, "Failed to keep the SSH client of another pool with the same host")
+	dialTestSSHConnection(t, otherConn, server)
+	assertEqual(t, server.getConnects(), 2, "Failed to reuse the SSH client of another pool with the same host")
+}
@@ -1,11 +1,11 @@
 package hosts
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"path/filepath"
 	"strings"
 	"syscall"
 
@@ -81,18 +81,87 @@ func parsePrivateKeyWithPassPhrase(keyBuff string, passphrase []byte) (ssh.Signe
 	return ssh.ParsePrivateKeyWithPassphrase([]byte(keyBuff), passphrase)
 }
 
-func makeSSHConfig(user string, signer ssh.Signer) (*ssh.ClientConfig, error) {
+func makeSSHConfig(h *Host, sshAddr string, signers []ssh.Signer) (*ssh.ClientConfig, error) {
 	config := ssh.ClientConfig{
-		User: user,
+		User: h.User,
 		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
+			ssh.PublicKeys(signers...),
 		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback:   h.hostKeyCallback(),
+		HostKeyAlgorithms: h.hostKeyAlgorithms(sshAddr),
 	}
 
 	return &config, nil
 }
 
+// getSSHSigners returns the keys of the ssh-agent with ssh_agent_auth, otherwise the private key of the host.
+// With an SSH certificate, the certificate is presented first with the key it was issued for
+func (h *Host) getSSHSigners() ([]ssh.Signer, error) {
+	var signers []ssh.Signer
+	if h.SSHAgentAuth != nil && *h.SSHAgentAuth {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if len(socket) == 0 {
+			return nil, fmt.Errorf("SSH_AUTH_SOCK is not set, ssh_agent_auth requires a running ssh-agent")
+		}
+		agentSigners, err := getAgentSigners(socket)
+		if err != nil {
+			return nil, err
+		}
+		if len(agentSigners) == 0 {
+			return nil, fmt.Errorf("ssh-agent has no keys, add them with ssh-add")
+		}
+		signers = agentSigners
+	} else {
+		key, err := h.checkEncryptedKey()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse the private key: %v", err)
+		}
+		signers = []ssh.Signer{key}
+	}
+	cert, err := h.getSSHCertificate()
+	if err != nil || cert == nil {
+		return signers, err
+	}
+	certSigners := []ssh.Signer{}
+	for _, signer := range signers {
+		if !bytes.Equal(signer.PublicKey().Marshal(), cert.Key.Marshal()) {
+			continue
+		}
+		certSigner, err := ssh.NewCertSigner(cert, signer)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to use the SSH certificate: %v", err)
+		}
+		certSigners = append(certSigners, certSigner)
+	}
+	if len(certSigners) == 0 {
+		return nil, fmt.Errorf("The SSH certificate wasn't issued for the private key or the ssh-agent keys")
+	}
+	return append(certSigners, signers...), nil
+}
+
+func (h *Host) getSSHCertificate() (*ssh.Certificate, error) {
+	certContent := h.SSHCert
+	if len(certContent) == 0 {
+		if len(h.SSHCertPath) == 0 {
+			return nil, nil
+		}
+		buff, err := ioutil.ReadFile(expandPath(h.SSHCertPath))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read the SSH certificate: %v", err)
+		}
+		certContent = string(buff)
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(certContent))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse the SSH certificate: %v", err)
+	}
+	cert, ok := pubKey.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("SSH certificate is a %s public key, not a certificate", pubKey.Type())
+	}
+	return cert, nil
+}
+
 func (h *Host) checkEncryptedKey() (ssh.Signer, error) {
 	logrus.Debugf("[ssh] Checking private key")
 	var err error
@@ -134,9 +203,6 @@ func (h *Host) checkEncryptedKey() (ssh.Signer, error) {
 }
 
 func privateKeyPath(sshKeyPath string) string {
-	if sshKeyPath[:2] == "~/" {
-		sshKeyPath = filepath.Join(os.Getenv("HOME"), sshKeyPath[2:])
-	}
-	buff, _ := ioutil.ReadFile(sshKeyPath)
+	buff, _ := ioutil.ReadFile(expandPath(sshKeyPath))
 	return string(buff)
 }
@@ -0,0 +1,119 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	drainRetryInterval  = 5 * time.Second
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+)
+
+// DrainNode evicts the pods running on the node, which should be cordoned first. DaemonSet and mirror pods are
+// skipped since they can't be rescheduled, and evictions blocked by a PodDisruptionBudget are retried until the timeout
+func DrainNode(k8sClient *kubernetes.Clientset, nodeName string, gracePeriod int, timeout time.Duration) error {
+	podList, err := k8sClient.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: "spec.nodeName=" + nodeName,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to list pods on node [%s]: %v", nodeName, err)
+	}
+	deadline := time.Now().Add(timeout)
+	toEvict := getPodsToEvict(podList.Items)
+	pending := toEvict
+	for {
+		blocked := []v1.Pod{}
+		for _, pod := range pending {
+			if err := evictPod(k8sClient, pod, gracePeriod); err != nil {
+				if !apierrors.IsTooManyRequests(err) {
+					return fmt.Errorf("Failed to evict pod [%s/%s] from node [%s]: %v", pod.Namespace, pod.Name, nodeName, err)
+				}
+				logrus.Debugf("Eviction of pod [%s/%s] is blocked by a disruption budget: %v", pod.Namespace, pod.Name, err)
+				blocked = append(blocked, pod)
+			}
+		}
+		if len(blocked) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Failed to evict pods [%s] from node [%s] within %v, their evictions are blocked by PodDisruptionBudgets", getPodNames(blocked), nodeName, timeout)
+		}
+		pending = blocked
+		time.Sleep(drainRetryInterval)
+	}
+	return waitForPodsDeletion(k8sClient, toEvict, nodeName, deadline, timeout)
+}
+
+func getPodsToEvict(pods []v1.Pod) []v1.Pod {
+	toEvict := []v1.Pod{}
+	for _, pod := range pods {
+		if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+			continue
+		}
+		if controllerRef := metav1.GetControllerOf(&pod); controllerRef != nil && controllerRef.Kind == "DaemonSet" {
+			continue
+		}
+		toEvict = append(toEvict, pod)
+	}
+	return toEvict
+}
+
+func evictPod(k8sClient *kubernetes.Clientset, pod v1.Pod, gracePeriod int) error {
+	eviction := &policy.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+	}
+	if gracePeriod > 0 {
+		gracePeriodSeconds := int64(gracePeriod)
+		eviction.DeleteOptions = &metav1.DeleteOptions{GracePeriodSeconds: &gracePeriodSeconds}
+	}
+	err := k8sClient.CoreV1().Pods(pod.Namespace).Evict(eviction)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func waitForPodsDeletion(k8sClient *kubernetes.Clientset, pods []v1.Pod, nodeName string, deadline time.Time, timeout time.Duration) error {
+	pending := pods
+	for {
+		remaining := []v1.Pod{}
+		for _, pod := range pending {
+			currentPod, err := k8sClient.CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) || (err == nil && currentPod.UID != pod.UID) {
+				continue
+			}
+			if err != nil {
+				logrus.Debugf("Failed to get pod [%s/%s]: %v", pod.Namespace, pod.Name, err)
+			}
+			remaining = append(remaining, pod)
+		}
+		if len(remaining) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timeout waiting for pods [%s] to be deleted from node [%s] after %v", getPodNames(remaining), nodeName, timeout)
+		}
+		pending = remaining
+		time.Sleep(drainRetryInterval)
+	}
+}
+
+func getPodNames(pods []v1.Pod) string {
+	names := []string{}
+	for _, pod := range pods {
+		names = append(names, pod.Namespace+"/"+pod.Name)
+	}
+	return strings.Join(names, ",")
+}
@@ -2,6 +2,7 @@ package k8s
 
 import (
 	"bytes"
+	"net"
 	"time"
 
 	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
@@ -16,12 +17,18 @@ const (
 
 type k8sCall func(*kubernetes.Clientset, interface{}) error
 
-func NewClient(kubeConfigPath string) (*kubernetes.Clientset, error) {
+// DialFunc opens the connections of the Kubernetes client, the connections are opened directly if it is nil
+type DialFunc func(network, address string) (net.Conn, error)
+
+func NewClient(kubeConfigPath string, dialer DialFunc) (*kubernetes.Clientset, error) {
 	// use the current admin kubeconfig
 	config, err := clientcmd.BuildConfigFromFlags("", kubeConfigPath)
 	if err != nil {
 		return nil, err
 	}
+	if dialer != nil {
+		config.Dial = dialer
+	}
 	K8sClientSet, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, err
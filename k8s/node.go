@@ -226,3 +226,19 @@ func toTaint(taintStr string) v1.Taint {
 		TimeAdded: metav1.Time{time.Now()},
 	}
 }
+
+func WaitForNodeReady(k8sClient *kubernetes.Clientset, nodeName string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		node, err := GetNode(k8sClient, nodeName)
+		if err != nil {
+			logrus.Debugf("Error getting node %s: %v", nodeName, err)
+		} else if IsNodeReady(*node) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timeout waiting for node [%s] to be ready after %v", nodeName, timeout)
+		}
+		time.Sleep(time.Second * 5)
+	}
+}
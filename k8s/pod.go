@@ -0,0 +1,15 @@
+package k8s
+
+import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+func GetPodList(k8sClient *kubernetes.Clientset) (*v1.PodList, error) {
+	return k8sClient.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{})
+}
+
+func GetEventList(k8sClient *kubernetes.Clientset) (*v1.EventList, error) {
+	return k8sClient.CoreV1().Events(metav1.NamespaceAll).List(metav1.ListOptions{})
+}
@@ -30,3 +30,19 @@ func UpdateSecret(k8sClient *kubernetes.Clientset, secretDataMap map[string][]by
 	}
 	return nil
 }
+
+// DeleteServiceAccountTokens deletes the service account token secrets in all namespaces, the token controller recreates them
+func DeleteServiceAccountTokens(k8sClient *kubernetes.Clientset) error {
+	secrets, err := k8sClient.CoreV1().Secrets(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: "type=" + string(v1.SecretTypeServiceAccountToken),
+	})
+	if err != nil {
+		return err
+	}
+	for _, secret := range secrets.Items {
+		if err := k8sClient.CoreV1().Secrets(secret.Namespace).Delete(secret.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
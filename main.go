@@ -34,6 +34,12 @@ func mainErr() error {
 		cmd.RemoveCommand(),
 		cmd.VersionCommand(),
 		cmd.ConfigCommand(),
+		cmd.EtcdCommand(),
+		cmd.CertificateCommand(),
+		cmd.StatusCommand(),
+		cmd.SupportBundleCommand(),
+		cmd.StateCommand(),
+		cmd.RollbackCommand(),
 	}
 	app.Flags = []cli.Flag{
 		cli.BoolFlag{
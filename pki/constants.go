@@ -23,3 +23,14 @@ const (
 	KubeAdminOrganizationName = "system:masters"
 	KubeAdminConfigPrefix     = "kube_config_"
 )
+
+// ComponentCertificates lists the certificates signed by the CA, the etcd entry covers the certificates of all etcd hosts
+var ComponentCertificates = []string{
+	KubeAPICertName,
+	KubeControllerCertName,
+	KubeSchedulerCertName,
+	KubeProxyCertName,
+	KubeNodeCertName,
+	KubeAdminCertName,
+	EtcdCertName,
+}
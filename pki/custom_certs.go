@@ -0,0 +1,165 @@
+package pki
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/log"
+	"k8s.io/client-go/util/cert"
+)
+
+// ReadCertificatesFromDir loads the cluster certificates from certDir, which holds either the CA certificate
+// and key only, in which case the components certificates are signed by that CA, or the complete set of certificates.
+// Files are named the same as on the hosts, for example kube-ca.pem and kube-ca-key.pem
+func ReadCertificatesFromDir(ctx context.Context, certDir string, cpHosts, etcdHosts []*hosts.Host, clusterDomain, localConfigPath string, KubernetesServiceIP net.IP) (map[string]CertificatePKI, error) {
+	log.Infof(ctx, "[certificates] Reading custom certificates from [%s]", certDir)
+	caCert, err := readCertAndKeyFromDir(certDir, CACertName)
+	if err != nil {
+		return nil, err
+	}
+	if caCert == nil {
+		return nil, fmt.Errorf("Failed to find CA certificate [%s] and key in [%s]", CACertName, certDir)
+	}
+
+	crtList := []string{
+		KubeAPICertName,
+		KubeControllerCertName,
+		KubeSchedulerCertName,
+		KubeProxyCertName,
+		KubeNodeCertName,
+		KubeAdminCertName,
+	}
+	for _, host := range etcdHosts {
+		crtList = append(crtList, GetEtcdCrtName(host.InternalAddress))
+	}
+	tmpCerts := map[string]CertificatePKI{
+		CACertName: *caCert,
+	}
+	missingCerts := []string{}
+	for _, crtName := range crtList {
+		certificate, err := readCertAndKeyFromDir(certDir, crtName)
+		if err != nil {
+			return nil, err
+		}
+		if certificate == nil {
+			missingCerts = append(missingCerts, crtName)
+			continue
+		}
+		tmpCerts[crtName] = *certificate
+	}
+
+	if len(missingCerts) == len(crtList) {
+		log.Infof(ctx, "[certificates] Found only CA certificate in [%s], generating certificates signed by the custom CA", certDir)
+		certs := map[string]CertificatePKI{
+			CACertName: ToCertObject(CACertName, "", "", caCert.Certificate, caCert.Key),
+		}
+		if err := GenerateComponentCertificates(ctx, certs, ComponentCertificates, cpHosts, etcdHosts, clusterDomain, localConfigPath, KubernetesServiceIP); err != nil {
+			return nil, err
+		}
+		return certs, nil
+	}
+	if len(missingCerts) > 0 {
+		return nil, fmt.Errorf("Failed to find certificates %v in [%s], either provide the CA certificate and key only or all the certificates", missingCerts, certDir)
+	}
+
+	if err := validateCustomCertificates(tmpCerts, cpHosts, etcdHosts); err != nil {
+		return nil, err
+	}
+	kubeAdminCert := tmpCerts[KubeAdminCertName]
+	kubeAdminCert.Config = GetKubeConfigX509WithData(
+		"https://"+cpHosts[0].Address+":6443",
+		KubeAdminCertName,
+		string(cert.EncodeCertPEM(caCert.Certificate)),
+		string(cert.EncodeCertPEM(kubeAdminCert.Certificate)),
+		string(cert.EncodePrivateKeyPEM(kubeAdminCert.Key)))
+	tmpCerts[KubeAdminCertName] = kubeAdminCert
+	log.Infof(ctx, "[certificates] Successfully loaded custom certificates from [%s]", certDir)
+	return populateCertMap(tmpCerts, localConfigPath, etcdHosts), nil
+}
+
+// readCertAndKeyFromDir returns nil if neither the certificate nor the key exist
+func readCertAndKeyFromDir(certDir, crtName string) (*CertificatePKI, error) {
+	crtPath := filepath.Join(certDir, crtName+".pem")
+	keyPath := filepath.Join(certDir, crtName+"-key.pem")
+	crt, crtErr := ioutil.ReadFile(crtPath)
+	key, keyErr := ioutil.ReadFile(keyPath)
+	if os.IsNotExist(crtErr) && os.IsNotExist(keyErr) {
+		return nil, nil
+	}
+	if crtErr != nil {
+		return nil, fmt.Errorf("Failed to read certificate [%s]: %v", crtPath, crtErr)
+	}
+	if keyErr != nil {
+		return nil, fmt.Errorf("Failed to read key [%s]: %v", keyPath, keyErr)
+	}
+	parsedCert, err := cert.ParseCertsPEM(crt)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse certificate [%s]: %v", crtPath, err)
+	}
+	parsedKey, err := cert.ParsePrivateKeyPEM(key)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse key [%s]: %v", keyPath, err)
+	}
+	rsaKey, ok := parsedKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("Key [%s] is not an RSA private key", keyPath)
+	}
+	publicKey, ok := parsedCert[0].PublicKey.(*rsa.PublicKey)
+	if !ok || publicKey.N.Cmp(rsaKey.N) != 0 {
+		return nil, fmt.Errorf("Key [%s] doesn't match certificate [%s]", keyPath, crtPath)
+	}
+	return &CertificatePKI{
+		Certificate: parsedCert[0],
+		Key:         rsaKey,
+	}, nil
+}
+
+func validateCustomCertificates(crtMap map[string]CertificatePKI, cpHosts, etcdHosts []*hosts.Host) error {
+	roots := x509.NewCertPool()
+	roots.AddCert(crtMap[CACertName].Certificate)
+	for crtName, certificate := range crtMap {
+		if crtName == CACertName {
+			continue
+		}
+		if _, err := certificate.Certificate.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+			return fmt.Errorf("Certificate [%s] is not signed by the custom CA: %v", crtName, err)
+		}
+	}
+	if err := validateCertificateSANs(crtMap[KubeAPICertName].Certificate, KubeAPICertName, cpHosts); err != nil {
+		return err
+	}
+	for _, host := range etcdHosts {
+		etcdName := GetEtcdCrtName(host.InternalAddress)
+		if err := validateCertificateSANs(crtMap[etcdName].Certificate, etcdName, etcdHosts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateCertificateSANs(certificate *x509.Certificate, crtName string, sanHosts []*hosts.Host) error {
+	if missingSANs := getMissingSANs(certificate, sanHosts); len(missingSANs) > 0 {
+		return fmt.Errorf("Certificate [%s] SANs don't cover hosts addresses [%s]", crtName, strings.Join(missingSANs, ","))
+	}
+	return nil
+}
+
+func getMissingSANs(certificate *x509.Certificate, sanHosts []*hosts.Host) []string {
+	missingSANs := []string{}
+	for _, host := range sanHosts {
+		for _, address := range []string{host.Address, host.InternalAddress} {
+			if err := certificate.VerifyHostname(address); err != nil {
+				missingSANs = append(missingSANs, address)
+			}
+		}
+	}
+	return missingSANs
+}
@@ -191,6 +191,7 @@ func FetchCertificatesFromHost(ctx context.Context, extraHosts []*hosts.Host, ho
 			return nil, err
 		}
 		certificate.Certificate = parsedCert[0]
+		certificate.BundledCert = GetBundledCert(parsedCert)
 		certificate.Key = parsedKey.(*rsa.PrivateKey)
 		tmpCerts[certName] = certificate
 		logrus.Debugf("[certificates] Recovered certificate: %s", certName)
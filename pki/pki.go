@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rsa"
 	"crypto/x509"
+	"fmt"
 	"net"
 
 	"github.com/rancher/rke/hosts"
@@ -24,6 +25,8 @@ type CertificatePKI struct {
 	KeyPath       string
 	ConfigEnvName string
 	ConfigPath    string
+	// BundledCert is appended to the certificate file, used to trust the old CA during CA rotation
+	BundledCert *x509.Certificate
 }
 
 // StartCertificatesGeneration ...
@@ -46,77 +49,114 @@ func generateCerts(ctx context.Context, cpHosts, etcdHosts []*hosts.Host, cluste
 	}
 	certs[CACertName] = ToCertObject(CACertName, "", "", caCrt, caKey)
 
-	// generate API certificate and key
-	log.Infof(ctx, "[certificates] Generating Kubernetes API server certificates")
-	kubeAPIAltNames := GetAltNames(cpHosts, clusterDomain, KubernetesServiceIP)
-	kubeAPICrt, kubeAPIKey, err := GenerateSignedCertAndKey(caCrt, caKey, true, KubeAPICertName, kubeAPIAltNames, nil, nil)
-	if err != nil {
-		return nil, err
-	}
-	certs[KubeAPICertName] = ToCertObject(KubeAPICertName, "", "", kubeAPICrt, kubeAPIKey)
-
-	// generate Kube controller-manager certificate and key
-	log.Infof(ctx, "[certificates] Generating Kube Controller certificates")
-	kubeControllerCrt, kubeControllerKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, getDefaultCN(KubeControllerCertName), nil, nil, nil)
-	if err != nil {
+	if err := GenerateComponentCertificates(ctx, certs, ComponentCertificates, cpHosts, etcdHosts, clusterDomain, localConfigPath, KubernetesServiceIP); err != nil {
 		return nil, err
 	}
-	certs[KubeControllerCertName] = ToCertObject(KubeControllerCertName, "", "", kubeControllerCrt, kubeControllerKey)
-
-	// generate Kube scheduler certificate and key
-	log.Infof(ctx, "[certificates] Generating Kube Scheduler certificates")
-	kubeSchedulerCrt, kubeSchedulerKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, getDefaultCN(KubeSchedulerCertName), nil, nil, nil)
-	if err != nil {
-		return nil, err
-	}
-	certs[KubeSchedulerCertName] = ToCertObject(KubeSchedulerCertName, "", "", kubeSchedulerCrt, kubeSchedulerKey)
-
-	// generate Kube Proxy certificate and key
-	log.Infof(ctx, "[certificates] Generating Kube Proxy certificates")
-	kubeProxyCrt, kubeProxyKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, getDefaultCN(KubeProxyCertName), nil, nil, nil)
-	if err != nil {
-		return nil, err
-	}
-	certs[KubeProxyCertName] = ToCertObject(KubeProxyCertName, "", "", kubeProxyCrt, kubeProxyKey)
+	return certs, nil
+}
 
-	// generate Kubelet certificate and key
-	log.Infof(ctx, "[certificates] Generating Node certificate")
-	nodeCrt, nodeKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, KubeNodeCommonName, nil, nil, []string{KubeNodeOrganizationName})
-	if err != nil {
-		return nil, err
+// GenerateComponentCertificates (re)issues the certificates of the given components in crtMap, signed by the CA found in crtMap
+func GenerateComponentCertificates(ctx context.Context, crtMap map[string]CertificatePKI, components []string, cpHosts, etcdHosts []*hosts.Host, clusterDomain, localConfigPath string, KubernetesServiceIP net.IP) error {
+	caCrt := crtMap[CACertName].Certificate
+	caKey := crtMap[CACertName].Key
+	for _, component := range components {
+		switch component {
+		case KubeAPICertName:
+			// generate API certificate and key
+			log.Infof(ctx, "[certificates] Generating Kubernetes API server certificates")
+			kubeAPIAltNames := GetAltNames(cpHosts, clusterDomain, KubernetesServiceIP)
+			// the API key is reused if it exists, since it also signs the service account tokens
+			kubeAPICrt, kubeAPIKey, err := GenerateSignedCertAndKey(caCrt, caKey, true, KubeAPICertName, kubeAPIAltNames, crtMap[KubeAPICertName].Key, nil)
+			if err != nil {
+				return err
+			}
+			crtMap[KubeAPICertName] = ToCertObject(KubeAPICertName, "", "", kubeAPICrt, kubeAPIKey)
+
+		case KubeControllerCertName:
+			// generate Kube controller-manager certificate and key
+			log.Infof(ctx, "[certificates] Generating Kube Controller certificates")
+			kubeControllerCrt, kubeControllerKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, getDefaultCN(KubeControllerCertName), nil, nil, nil)
+			if err != nil {
+				return err
+			}
+			crtMap[KubeControllerCertName] = ToCertObject(KubeControllerCertName, "", "", kubeControllerCrt, kubeControllerKey)
+
+		case KubeSchedulerCertName:
+			// generate Kube scheduler certificate and key
+			log.Infof(ctx, "[certificates] Generating Kube Scheduler certificates")
+			kubeSchedulerCrt, kubeSchedulerKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, getDefaultCN(KubeSchedulerCertName), nil, nil, nil)
+			if err != nil {
+				return err
+			}
+			crtMap[KubeSchedulerCertName] = ToCertObject(KubeSchedulerCertName, "", "", kubeSchedulerCrt, kubeSchedulerKey)
+
+		case KubeProxyCertName:
+			// generate Kube Proxy certificate and key
+			log.Infof(ctx, "[certificates] Generating Kube Proxy certificates")
+			kubeProxyCrt, kubeProxyKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, getDefaultCN(KubeProxyCertName), nil, nil, nil)
+			if err != nil {
+				return err
+			}
+			crtMap[KubeProxyCertName] = ToCertObject(KubeProxyCertName, "", "", kubeProxyCrt, kubeProxyKey)
+
+		case KubeNodeCertName:
+			// generate Kubelet certificate and key
+			log.Infof(ctx, "[certificates] Generating Node certificate")
+			nodeCrt, nodeKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, KubeNodeCommonName, nil, nil, []string{KubeNodeOrganizationName})
+			if err != nil {
+				return err
+			}
+			crtMap[KubeNodeCertName] = ToCertObject(KubeNodeCertName, KubeNodeCommonName, KubeNodeOrganizationName, nodeCrt, nodeKey)
+
+		case KubeAdminCertName:
+			// generate Admin certificate and key
+			log.Infof(ctx, "[certificates] Generating admin certificates and kubeconfig")
+			kubeAdminCrt, kubeAdminKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, KubeAdminCertName, nil, nil, []string{KubeAdminOrganizationName})
+			if err != nil {
+				return err
+			}
+			kubeAdminConfig := GetKubeConfigX509WithData(
+				"https://"+cpHosts[0].Address+":6443",
+				KubeAdminCertName,
+				string(cert.EncodeCertPEM(caCrt)),
+				string(cert.EncodeCertPEM(kubeAdminCrt)),
+				string(cert.EncodePrivateKeyPEM(kubeAdminKey)))
+
+			kubeAdminCertObj := ToCertObject(KubeAdminCertName, KubeAdminCertName, KubeAdminOrganizationName, kubeAdminCrt, kubeAdminKey)
+			kubeAdminCertObj.Config = kubeAdminConfig
+			kubeAdminCertObj.ConfigPath = localConfigPath
+			crtMap[KubeAdminCertName] = kubeAdminCertObj
+
+		case EtcdCertName:
+			etcdAltNames := GetAltNames(etcdHosts, clusterDomain, KubernetesServiceIP)
+			for _, host := range etcdHosts {
+				log.Infof(ctx, "[certificates] Generating etcd-%s certificate and key", host.InternalAddress)
+				etcdCrt, etcdKey, err := GenerateSignedCertAndKey(caCrt, caKey, true, EtcdCertName, etcdAltNames, nil, nil)
+				if err != nil {
+					return err
+				}
+				etcdName := GetEtcdCrtName(host.InternalAddress)
+				crtMap[etcdName] = ToCertObject(etcdName, "", "", etcdCrt, etcdKey)
+			}
+
+		default:
+			return fmt.Errorf("Unknown certificate component [%s]", component)
+		}
 	}
-	certs[KubeNodeCertName] = ToCertObject(KubeNodeCertName, KubeNodeCommonName, KubeNodeOrganizationName, nodeCrt, nodeKey)
+	return nil
+}
 
-	// generate Admin certificate and key
-	log.Infof(ctx, "[certificates] Generating admin certificates and kubeconfig")
-	kubeAdminCrt, kubeAdminKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, KubeAdminCertName, nil, nil, []string{KubeAdminOrganizationName})
+// RotateCACertificate replaces the CA in crtMap with a new one, keeping the old CA in the bundle until the components certificates are reissued
+func RotateCACertificate(ctx context.Context, crtMap map[string]CertificatePKI) error {
+	log.Infof(ctx, "[certificates] Generating new CA kubernetes certificates")
+	caCrt, caKey, err := generateCACertAndKey()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	kubeAdminConfig := GetKubeConfigX509WithData(
-		"https://"+cpHosts[0].Address+":6443",
-		KubeAdminCertName,
-		string(cert.EncodeCertPEM(caCrt)),
-		string(cert.EncodeCertPEM(kubeAdminCrt)),
-		string(cert.EncodePrivateKeyPEM(kubeAdminKey)))
-
-	kubeAdminCertObj := ToCertObject(KubeAdminCertName, KubeAdminCertName, KubeAdminOrganizationName, kubeAdminCrt, kubeAdminKey)
-	kubeAdminCertObj.Config = kubeAdminConfig
-	kubeAdminCertObj.ConfigPath = localConfigPath
-	certs[KubeAdminCertName] = kubeAdminCertObj
-
-	etcdAltNames := GetAltNames(etcdHosts, clusterDomain, KubernetesServiceIP)
-	for _, host := range etcdHosts {
-		log.Infof(ctx, "[certificates] Generating etcd-%s certificate and key", host.InternalAddress)
-		etcdCrt, etcdKey, err := GenerateSignedCertAndKey(caCrt, caKey, true, EtcdCertName, etcdAltNames, nil, nil)
-		if err != nil {
-			return nil, err
-		}
-		etcdName := GetEtcdCrtName(host.InternalAddress)
-		certs[etcdName] = ToCertObject(etcdName, "", "", etcdCrt, etcdKey)
-	}
-
-	return certs, nil
+	caCertObj := ToCertObject(CACertName, "", "", caCrt, caKey)
+	caCertObj.BundledCert = crtMap[CACertName].Certificate
+	crtMap[CACertName] = caCertObj
+	return nil
 }
 
 func RegenerateEtcdCertificate(
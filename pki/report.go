@@ -0,0 +1,59 @@
+package pki
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rancher/rke/hosts"
+)
+
+type CertificateReport struct {
+	Name          string    `json:"name"`
+	Subject       string    `json:"subject"`
+	Issuer        string    `json:"issuer"`
+	DNSNames      []string  `json:"dnsNames,omitempty"`
+	IPAddresses   []string  `json:"ipAddresses,omitempty"`
+	NotAfter      time.Time `json:"notAfter"`
+	DaysRemaining int       `json:"daysRemaining"`
+	MissingSANs   []string  `json:"missingSANs,omitempty"`
+}
+
+// GetCertificatesReport reports the expiry and SANs of the certificates in crtMap, sorted by name. Missing SANs
+// are reported for the kube-apiserver and etcd certificates against the current control plane and etcd hosts
+func GetCertificatesReport(crtMap map[string]CertificatePKI, cpHosts, etcdHosts []*hosts.Host, now time.Time) []CertificateReport {
+	reports := []CertificateReport{}
+	for crtName, certificate := range crtMap {
+		crt := certificate.Certificate
+		report := CertificateReport{
+			Name:          crtName,
+			Subject:       getCertificateName(crt.Subject.CommonName, crt.Subject.Organization),
+			Issuer:        getCertificateName(crt.Issuer.CommonName, crt.Issuer.Organization),
+			DNSNames:      crt.DNSNames,
+			NotAfter:      crt.NotAfter,
+			DaysRemaining: int(crt.NotAfter.Sub(now).Hours() / 24),
+		}
+		for _, ip := range crt.IPAddresses {
+			report.IPAddresses = append(report.IPAddresses, ip.String())
+		}
+		if crtName == KubeAPICertName {
+			report.MissingSANs = getMissingSANs(crt, cpHosts)
+		} else if strings.HasPrefix(crtName, EtcdCertName) {
+			report.MissingSANs = getMissingSANs(crt, etcdHosts)
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Name < reports[j].Name
+	})
+	return reports
+}
+
+func getCertificateName(commonName string, orgs []string) string {
+	name := fmt.Sprintf("CN=%s", commonName)
+	if len(orgs) > 0 {
+		name += fmt.Sprintf(",O=%s", strings.Join(orgs, "+"))
+	}
+	return name
+}
@@ -5,12 +5,18 @@ import (
 	"crypto/x509"
 	"fmt"
 	"net"
+	"regexp"
 	"strings"
 
 	"github.com/rancher/rke/hosts"
 	"k8s.io/client-go/util/cert"
 )
 
+var (
+	privateKeyPEMRegexp  = regexp.MustCompile(`(?s)-----BEGIN ([A-Z ]*PRIVATE KEY)-----.*?-----END [A-Z ]*PRIVATE KEY-----`)
+	privateKeyDataRegexp = regexp.MustCompile(`(client-key-data|token):[ \t]*\S+`)
+)
+
 func GenerateSignedCertAndKey(
 	caCrt *x509.Certificate,
 	caKey *rsa.PrivateKey,
@@ -116,8 +122,24 @@ func (c *CertificatePKI) ToEnv() []string {
 }
 
 func (c *CertificatePKI) CertToEnv() string {
+	return fmt.Sprintf("%s=%s", c.EnvName, string(c.CertPEM()))
+}
+
+// CertPEM encodes the certificate followed by the bundled certificate, if any
+func (c *CertificatePKI) CertPEM() []byte {
 	encodedCrt := cert.EncodeCertPEM(c.Certificate)
-	return fmt.Sprintf("%s=%s", c.EnvName, string(encodedCrt))
+	if c.BundledCert != nil {
+		encodedCrt = append(encodedCrt, cert.EncodeCertPEM(c.BundledCert)...)
+	}
+	return encodedCrt
+}
+
+// GetBundledCert returns the certificate bundled after the first certificate of a PEM file
+func GetBundledCert(certs []*x509.Certificate) *x509.Certificate {
+	if len(certs) > 1 {
+		return certs[1]
+	}
+	return nil
 }
 
 func (c *CertificatePKI) KeyToEnv() string {
@@ -207,3 +229,9 @@ func ToCertObject(componentName, commonName, ouName string, cert *x509.Certifica
 func getDefaultCN(name string) string {
 	return fmt.Sprintf("system:%s", name)
 }
+
+// RedactPrivateKeys replaces the PEM encoded private keys and the embedded kubeconfig keys and tokens of the content
+func RedactPrivateKeys(content []byte) []byte {
+	content = privateKeyPEMRegexp.ReplaceAll(content, []byte("-----BEGIN $1-----\nREDACTED\n-----END $1-----"))
+	return privateKeyDataRegexp.ReplaceAll(content, []byte("$1: REDACTED"))
+}
@@ -2,7 +2,9 @@ package services
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/rancher/rke/docker"
 	"github.com/rancher/rke/hosts"
 	"github.com/rancher/rke/log"
 	"github.com/rancher/types/apis/management.cattle.io/v3"
@@ -11,6 +13,18 @@ import (
 
 func RunControlPlane(ctx context.Context, controlHosts, etcdHosts []*hosts.Host, controlServices v3.RKEConfigServices, sidekickImage, authorizationMode string, localConnDialerFactory hosts.DialerFactory, prsMap map[string]v3.PrivateRegistry) error {
 	log.Infof(ctx, "[%s] Building up Controller Plane..", ControlRole)
+	rolling, err := isControlPlaneRunning(ctx, controlHosts)
+	if err != nil {
+		return err
+	}
+	if rolling {
+		// updating all the hosts at once would take the kubernetes API down
+		if err := rollingUpdateControlPlane(ctx, controlHosts, etcdHosts, controlServices, sidekickImage, authorizationMode, localConnDialerFactory, prsMap); err != nil {
+			return err
+		}
+		log.Infof(ctx, "[%s] Successfully started Controller Plane..", ControlRole)
+		return nil
+	}
 	var errgrp errgroup.Group
 	for _, host := range controlHosts {
 		runHost := host
@@ -25,6 +39,44 @@ func RunControlPlane(ctx context.Context, controlHosts, etcdHosts []*hosts.Host,
 	return nil
 }
 
+func rollingUpdateControlPlane(ctx context.Context, controlHosts, etcdHosts []*hosts.Host, controlServices v3.RKEConfigServices, sidekickImage, authorizationMode string, localConnDialerFactory hosts.DialerFactory, prsMap map[string]v3.PrivateRegistry) error {
+	for i, host := range controlHosts {
+		log.Infof(ctx, "[%s] Rolling update of Controller Plane on host [%s] (%d/%d)", ControlRole, host.Address, i+1, len(controlHosts))
+		err := doDeployControlHost(ctx, host, etcdHosts, controlServices, sidekickImage, authorizationMode, localConnDialerFactory, prsMap)
+		if err == nil {
+			err = checkControlHostHealth(ctx, host, localConnDialerFactory)
+		}
+		if err != nil {
+			return fmt.Errorf("Rolling update of Controller Plane aborted on host [%s], hosts [%s] were left untouched: %v", host.Address, getHostsAddresses(controlHosts[i+1:]), err)
+		}
+	}
+	return nil
+}
+
+// checkControlHostHealth makes sure all the components are still healthy after the host update, before moving to the next host
+func checkControlHostHealth(ctx context.Context, host *hosts.Host, localConnDialerFactory hosts.DialerFactory) error {
+	if err := runHealthcheck(ctx, host, KubeAPIPort, true, KubeAPIContainerName, localConnDialerFactory); err != nil {
+		return err
+	}
+	if err := runHealthcheck(ctx, host, KubeControllerPort, false, KubeControllerContainerName, localConnDialerFactory); err != nil {
+		return err
+	}
+	return runHealthcheck(ctx, host, SchedulerPort, false, SchedulerContainerName, localConnDialerFactory)
+}
+
+func isControlPlaneRunning(ctx context.Context, controlHosts []*hosts.Host) (bool, error) {
+	for _, host := range controlHosts {
+		running, err := docker.IsContainerRunning(ctx, host.DClient, host.Address, KubeAPIContainerName, false)
+		if err != nil {
+			return false, err
+		}
+		if running {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func RemoveControlPlane(ctx context.Context, controlHosts []*hosts.Host, force bool) error {
 	log.Infof(ctx, "[%s] Tearing down the Controller Plane..", ControlRole)
 	for _, host := range controlHosts {
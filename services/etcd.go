@@ -2,6 +2,7 @@ package services
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
 	"context"
@@ -16,9 +17,12 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func RunEtcdPlane(ctx context.Context, etcdHosts []*hosts.Host, etcdService v3.ETCDService, localConnDialerFactory hosts.DialerFactory, prsMap map[string]v3.PrivateRegistry) error {
+func RunEtcdPlane(ctx context.Context, etcdHosts []*hosts.Host, etcdService v3.ETCDService, localConnDialerFactory hosts.DialerFactory, prsMap map[string]v3.PrivateRegistry, cert, key []byte) error {
 	log.Infof(ctx, "[%s] Building up Etcd Plane..", ETCDRole)
 	initCluster := getEtcdInitialCluster(etcdHosts)
+	if err := rollingUpdateEtcdPlane(ctx, etcdHosts, etcdService, initCluster, localConnDialerFactory, prsMap, cert, key); err != nil {
+		return err
+	}
 	for _, host := range etcdHosts {
 
 		nodeName := pki.GetEtcdCrtName(host.InternalAddress)
@@ -27,11 +31,94 @@ func RunEtcdPlane(ctx context.Context, etcdHosts []*hosts.Host, etcdService v3.E
 		if err != nil {
 			return err
 		}
+		if err := runEtcdRollingSnapshots(ctx, host, etcdService, prsMap); err != nil {
+			return err
+		}
 	}
 	log.Infof(ctx, "[%s] Successfully started Etcd Plane..", ETCDRole)
 	return nil
 }
 
+// rollingUpdateEtcdPlane restarts the running etcd members that need to be updated one at a time, the leader last,
+// and waits for each member to be healthy before moving to the next one
+func rollingUpdateEtcdPlane(ctx context.Context, etcdHosts []*hosts.Host, etcdService v3.ETCDService, initCluster string, localConnDialerFactory hosts.DialerFactory, prsMap map[string]v3.PrivateRegistry, cert, key []byte) error {
+	runningHosts := []*hosts.Host{}
+	toUpdateHosts := []*hosts.Host{}
+	for _, host := range etcdHosts {
+		running, err := docker.IsContainerRunning(ctx, host.DClient, host.Address, EtcdContainerName, false)
+		if err != nil {
+			return err
+		}
+		if !running {
+			continue
+		}
+		runningHosts = append(runningHosts, host)
+		imageCfg, _ := buildEtcdConfig(host, etcdService, initCluster, pki.GetEtcdCrtName(host.InternalAddress))
+		upgradable, err := docker.IsContainerUpgradable(ctx, host.DClient, imageCfg, EtcdContainerName, host.Address, ETCDRole)
+		if err != nil {
+			return err
+		}
+		if upgradable {
+			toUpdateHosts = append(toUpdateHosts, host)
+		}
+	}
+	if len(toUpdateHosts) == 0 {
+		return nil
+	}
+	for _, host := range runningHosts {
+		if !isEtcdHealthy(ctx, localConnDialerFactory, host, cert, key) {
+			return fmt.Errorf("Etcd member on host [%s] is not healthy, refusing to update the etcd plane until the etcd cluster is healthy", host.Address)
+		}
+	}
+	toUpdateHosts = moveEtcdLeaderLast(ctx, toUpdateHosts, runningHosts, localConnDialerFactory, cert, key)
+	for _, host := range toUpdateHosts {
+		log.Infof(ctx, "[%s] Updating etcd member [etcd-%s] on host [%s]", ETCDRole, host.HostnameOverride, host.Address)
+		imageCfg, hostCfg := buildEtcdConfig(host, etcdService, initCluster, pki.GetEtcdCrtName(host.InternalAddress))
+		if err := docker.DoRollingUpdateContainer(ctx, host.DClient, imageCfg, hostCfg, EtcdContainerName, host.Address, ETCDRole, prsMap); err != nil {
+			return err
+		}
+		if !isEtcdHealthy(ctx, localConnDialerFactory, host, cert, key) {
+			return fmt.Errorf("Etcd member [etcd-%s] on host [%s] is not healthy after its update, stopping the etcd plane update", host.HostnameOverride, host.Address)
+		}
+	}
+	return nil
+}
+
+func moveEtcdLeaderLast(ctx context.Context, toUpdateHosts, runningHosts []*hosts.Host, localConnDialerFactory hosts.DialerFactory, cert, key []byte) []*hosts.Host {
+	leaderName := ""
+	for _, host := range runningHosts {
+		etcdClient, err := getEtcdClient(ctx, host, localConnDialerFactory, cert, key)
+		if err != nil {
+			logrus.Debugf("Failed to create etcd client for host [%s]: %v", host.Address, err)
+			continue
+		}
+		leader, err := etcdclient.NewMembersAPI(etcdClient).Leader(ctx)
+		if err != nil {
+			logrus.Debugf("Failed to get etcd leader from host [%s]: %v", host.Address, err)
+			continue
+		}
+		leaderName = leader.Name
+		break
+	}
+	if len(leaderName) == 0 {
+		log.Warnf(ctx, "[%s] Failed to find the etcd leader, updating etcd members in the cluster file order", ETCDRole)
+		return toUpdateHosts
+	}
+	ordered := []*hosts.Host{}
+	var leaderHost *hosts.Host
+	for _, host := range toUpdateHosts {
+		if fmt.Sprintf("etcd-%s", host.HostnameOverride) == leaderName {
+			leaderHost = host
+			continue
+		}
+		ordered = append(ordered, host)
+	}
+	if leaderHost != nil {
+		ordered = append(ordered, leaderHost)
+	}
+	return ordered
+}
+
 func RemoveEtcdPlane(ctx context.Context, etcdHosts []*hosts.Host, force bool) error {
 	log.Infof(ctx, "[%s] Tearing down Etcd Plane..", ETCDRole)
 	for _, host := range etcdHosts {
@@ -39,6 +126,9 @@ func RemoveEtcdPlane(ctx context.Context, etcdHosts []*hosts.Host, force bool) e
 		if err != nil {
 			return err
 		}
+		if err := removeEtcdRollingSnapshots(ctx, host); err != nil {
+			return err
+		}
 		if !host.IsWorker || !host.IsControl || force {
 			// remove unschedulable kubelet on etcd host
 			if err := removeKubelet(ctx, host); err != nil {
@@ -95,9 +185,14 @@ func buildEtcdConfig(host *hosts.Host, etcdService v3.ETCDService, initCluster,
 		},
 		NetworkMode: "host",
 	}
-	for arg, value := range etcdService.ExtraArgs {
-		cmd := fmt.Sprintf("--%s=%s", arg, value)
-		imageCfg.Entrypoint = append(imageCfg.Entrypoint, cmd)
+	// extra args are sorted to keep the command stable between runs, a changed command triggers a rolling update
+	extraArgs := []string{}
+	for arg := range etcdService.ExtraArgs {
+		extraArgs = append(extraArgs, arg)
+	}
+	sort.Strings(extraArgs)
+	for _, arg := range extraArgs {
+		imageCfg.Cmd = append(imageCfg.Cmd, fmt.Sprintf("--%s=%s", arg, etcdService.ExtraArgs[arg]))
 	}
 
 	return imageCfg, hostCfg
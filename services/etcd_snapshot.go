@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/rancher/rke/backup"
+	"github.com/rancher/rke/docker"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/log"
+	"github.com/rancher/rke/pki"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+)
+
+const (
+	EtcdSnapshotPath                  = "/opt/rke/etcd-snapshots"
+	EtcdSnapshotContainerName         = "etcd-snapshot-once"
+	EtcdRestoreContainerName          = "etcd-restore"
+	EtcdSnapshotCheckContainerName    = "etcd-snapshot-check"
+	EtcdRollingSnapshotContainerName  = "etcd-rolling-snapshots"
+	EtcdSnapshotTransferContainerName = "etcd-snapshot-transfer"
+	EtcdSnapshotMountPath             = "/backup"
+	EtcdRollingSnapshotPrefix         = "rolling-snapshot-"
+)
+
+// snapshot names are used as file names in the snapshots directory
+var etcdSnapshotNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+func ValidateEtcdSnapshotName(snapshotName string) error {
+	if !etcdSnapshotNameRegexp.MatchString(snapshotName) {
+		return fmt.Errorf("Snapshot name [%s] is not valid, it can only contain letters, digits, '.', '_' and '-'", snapshotName)
+	}
+	return nil
+}
+
+func RunEtcdSnapshotSave(ctx context.Context, etcdHost *hosts.Host, etcdService v3.ETCDService, snapshotName string, prsMap map[string]v3.PrivateRegistry) error {
+	log.Infof(ctx, "[%s] Saving snapshot [%s] on host [%s]", ETCDRole, snapshotName, etcdHost.Address)
+	imageCfg, hostCfg := buildEtcdSnapshotConfig(etcdHost, etcdService, snapshotName)
+	if err := runEtcdOneShotContainer(ctx, etcdHost, imageCfg, hostCfg, EtcdSnapshotContainerName, prsMap); err != nil {
+		return err
+	}
+	log.Infof(ctx, "[%s] Successfully saved snapshot [%s] on host [%s]", ETCDRole, snapshotName, etcdHost.Address)
+	return nil
+}
+
+func runEtcdRollingSnapshots(ctx context.Context, etcdHost *hosts.Host, etcdService v3.ETCDService, prsMap map[string]v3.PrivateRegistry) error {
+	if etcdService.Snapshot == nil {
+		return removeEtcdRollingSnapshots(ctx, etcdHost)
+	}
+	imageCfg, hostCfg, err := buildEtcdRollingSnapshotConfig(etcdHost, etcdService)
+	if err != nil {
+		return err
+	}
+	return docker.DoRunContainer(ctx, etcdHost.DClient, imageCfg, hostCfg, EtcdRollingSnapshotContainerName, etcdHost.Address, ETCDRole, prsMap)
+}
+
+func removeEtcdRollingSnapshots(ctx context.Context, etcdHost *hosts.Host) error {
+	return docker.DoRemoveContainer(ctx, etcdHost.DClient, EtcdRollingSnapshotContainerName, etcdHost.Address)
+}
+
+func RestoreEtcdSnapshot(ctx context.Context, etcdHost *hosts.Host, etcdService v3.ETCDService, snapshotName string, prsMap map[string]v3.PrivateRegistry) error {
+	log.Infof(ctx, "[%s] Restoring snapshot [%s] on host [%s]", ETCDRole, snapshotName, etcdHost.Address)
+	// the snapshot is restored as a single member cluster, other members are added back later
+	initCluster := getEtcdInitialCluster([]*hosts.Host{etcdHost})
+	imageCfg, hostCfg := buildEtcdRestoreConfig(etcdHost, etcdService, snapshotName, initCluster)
+	if err := runEtcdOneShotContainer(ctx, etcdHost, imageCfg, hostCfg, EtcdRestoreContainerName, prsMap); err != nil {
+		return err
+	}
+	log.Infof(ctx, "[%s] Successfully restored snapshot [%s] on host [%s]", ETCDRole, snapshotName, etcdHost.Address)
+	return nil
+}
+
+// CheckEtcdSnapshot makes sure the snapshot exists on the host before any etcd data is touched
+func CheckEtcdSnapshot(ctx context.Context, etcdHost *hosts.Host, etcdService v3.ETCDService, snapshotName string, prsMap map[string]v3.PrivateRegistry) error {
+	imageCfg := &container.Config{
+		Image: etcdService.Image,
+		Tty:   true,
+		Cmd:   []string{"/bin/sh", "-c", "test -s \"$1\"", EtcdSnapshotCheckContainerName, EtcdSnapshotMountPath + "/" + snapshotName},
+	}
+	hostCfg := &container.HostConfig{
+		Binds: []string{
+			EtcdSnapshotPath + ":" + EtcdSnapshotMountPath + ":z",
+		},
+	}
+	if err := runEtcdOneShotContainer(ctx, etcdHost, imageCfg, hostCfg, EtcdSnapshotCheckContainerName, prsMap); err != nil {
+		return fmt.Errorf("Failed to find snapshot [%s] in [%s] on host [%s]: %v", snapshotName, EtcdSnapshotPath, etcdHost.Address, err)
+	}
+	return nil
+}
+
+func UploadEtcdSnapshot(ctx context.Context, etcdHost *hosts.Host, etcdService v3.ETCDService, snapshotName string, target backup.Target, prsMap map[string]v3.PrivateRegistry) error {
+	log.Infof(ctx, "[%s] Uploading snapshot [%s] from host [%s] to backup target", ETCDRole, snapshotName, etcdHost.Address)
+	if err := createEtcdSnapshotTransferContainer(ctx, etcdHost, etcdService, prsMap); err != nil {
+		return err
+	}
+	snapshotReader, size, err := docker.ReadFileStreamFromContainer(ctx, etcdHost.DClient, etcdHost.Address, EtcdSnapshotTransferContainerName, EtcdSnapshotMountPath+"/"+snapshotName)
+	if err != nil {
+		return err
+	}
+	defer snapshotReader.Close()
+	if err := target.Upload(ctx, snapshotName, snapshotReader, size); err != nil {
+		return err
+	}
+	if err := docker.RemoveContainer(ctx, etcdHost.DClient, etcdHost.Address, EtcdSnapshotTransferContainerName); err != nil {
+		return err
+	}
+	log.Infof(ctx, "[%s] Successfully uploaded snapshot [%s] to backup target", ETCDRole, snapshotName)
+	return nil
+}
+
+func DownloadEtcdSnapshot(ctx context.Context, etcdHost *hosts.Host, etcdService v3.ETCDService, snapshotName string, target backup.Target, prsMap map[string]v3.PrivateRegistry) error {
+	log.Infof(ctx, "[%s] Downloading snapshot [%s] from backup target to host [%s]", ETCDRole, snapshotName, etcdHost.Address)
+	if err := createEtcdSnapshotTransferContainer(ctx, etcdHost, etcdService, prsMap); err != nil {
+		return err
+	}
+	snapshotReader, size, err := target.Download(ctx, snapshotName)
+	if err != nil {
+		return err
+	}
+	defer snapshotReader.Close()
+	if err := docker.WriteFileToContainer(ctx, etcdHost.DClient, etcdHost.Address, EtcdSnapshotTransferContainerName, EtcdSnapshotMountPath, snapshotName, snapshotReader, size); err != nil {
+		return err
+	}
+	if err := docker.RemoveContainer(ctx, etcdHost.DClient, etcdHost.Address, EtcdSnapshotTransferContainerName); err != nil {
+		return err
+	}
+	log.Infof(ctx, "[%s] Successfully downloaded snapshot [%s] to host [%s]", ETCDRole, snapshotName, etcdHost.Address)
+	return nil
+}
+
+// createEtcdSnapshotTransferContainer creates, without starting, a container that mounts the snapshots directory to copy files in and out of it
+func createEtcdSnapshotTransferContainer(ctx context.Context, etcdHost *hosts.Host, etcdService v3.ETCDService, prsMap map[string]v3.PrivateRegistry) error {
+	if err := docker.DoRemoveContainer(ctx, etcdHost.DClient, EtcdSnapshotTransferContainerName, etcdHost.Address); err != nil {
+		return err
+	}
+	if err := docker.UseLocalOrPull(ctx, etcdHost.DClient, etcdHost.Address, etcdService.Image, ETCDRole, prsMap); err != nil {
+		return err
+	}
+	imageCfg := &container.Config{
+		Image: etcdService.Image,
+	}
+	hostCfg := &container.HostConfig{
+		Binds: []string{
+			EtcdSnapshotPath + ":" + EtcdSnapshotMountPath + ":z",
+		},
+	}
+	_, err := docker.CreateContiner(ctx, etcdHost.DClient, etcdHost.Address, EtcdSnapshotTransferContainerName, imageCfg, hostCfg)
+	return err
+}
+
+func RemoveEtcdMemberData(ctx context.Context, etcdHost *hosts.Host, etcdService v3.ETCDService, prsMap map[string]v3.PrivateRegistry) error {
+	log.Infof(ctx, "[%s] Removing member data on host [%s]", ETCDRole, etcdHost.Address)
+	imageCfg := &container.Config{
+		Image: etcdService.Image,
+		Tty:   true,
+		Cmd:   []string{"rm", "-rf", "/etcd-data/member"},
+	}
+	hostCfg := &container.HostConfig{
+		Binds: []string{
+			"/var/lib/etcd:/etcd-data:z",
+		},
+	}
+	return runEtcdOneShotContainer(ctx, etcdHost, imageCfg, hostCfg, EtcdRestoreContainerName, prsMap)
+}
+
+func buildEtcdSnapshotConfig(host *hosts.Host, etcdService v3.ETCDService, snapshotName string) (*container.Config, *container.HostConfig) {
+	imageCfg := &container.Config{
+		Image: etcdService.Image,
+		Tty:   true,
+		Env:   []string{"ETCDCTL_API=3"},
+		Cmd: []string{"/usr/local/bin/etcdctl",
+			"--endpoints=https://" + host.InternalAddress + ":2379",
+			"--cacert=" + pki.GetCertPath(pki.CACertName),
+			"--cert=" + pki.GetCertPath(pki.KubeNodeCertName),
+			"--key=" + pki.GetKeyPath(pki.KubeNodeCertName),
+			"snapshot", "save", EtcdSnapshotMountPath + "/" + snapshotName,
+		},
+	}
+	hostCfg := &container.HostConfig{
+		Binds: []string{
+			EtcdSnapshotPath + ":" + EtcdSnapshotMountPath + ":z",
+			"/etc/kubernetes:/etc/kubernetes:z",
+		},
+		NetworkMode: "host",
+	}
+	return imageCfg, hostCfg
+}
+
+func buildEtcdRollingSnapshotConfig(host *hosts.Host, etcdService v3.ETCDService) (*container.Config, *container.HostConfig, error) {
+	interval, err := time.ParseDuration(etcdService.Snapshot.Interval)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse etcd snapshot interval [%s]: %v", etcdService.Snapshot.Interval, err)
+	}
+	retention, err := time.ParseDuration(etcdService.Snapshot.Retention)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse etcd snapshot retention [%s]: %v", etcdService.Snapshot.Retention, err)
+	}
+	// all the settings are part of the command, so any change to them is picked up as a container upgrade
+	snapshotCmd := fmt.Sprintf("while true; do "+
+		"/usr/local/bin/etcdctl "+
+		"--endpoints=https://%s:2379 "+
+		"--cacert=%s "+
+		"--cert=%s "+
+		"--key=%s "+
+		"snapshot save %s/%s$(date -u +%%Y-%%m-%%dT%%H-%%M-%%SZ); "+
+		"find %s -name '%s*' -mmin +%d -exec rm -f {} \\;; "+
+		"sleep %d; done",
+		host.InternalAddress,
+		pki.GetCertPath(pki.CACertName),
+		pki.GetCertPath(pki.KubeNodeCertName),
+		pki.GetKeyPath(pki.KubeNodeCertName),
+		EtcdSnapshotMountPath, EtcdRollingSnapshotPrefix,
+		EtcdSnapshotMountPath, EtcdRollingSnapshotPrefix, int(retention.Minutes()),
+		int(interval.Seconds()))
+	imageCfg := &container.Config{
+		Image: etcdService.Image,
+		Env:   []string{"ETCDCTL_API=3"},
+		Cmd:   []string{"/bin/sh", "-c", snapshotCmd},
+	}
+	hostCfg := &container.HostConfig{
+		Binds: []string{
+			EtcdSnapshotPath + ":" + EtcdSnapshotMountPath + ":z",
+			"/etc/kubernetes:/etc/kubernetes:z",
+		},
+		NetworkMode:   "host",
+		RestartPolicy: container.RestartPolicy{Name: "always"},
+	}
+	return imageCfg, hostCfg, nil
+}
+
+func buildEtcdRestoreConfig(host *hosts.Host, etcdService v3.ETCDService, snapshotName, initCluster string) (*container.Config, *container.HostConfig) {
+	// etcdctl refuses to restore into an existing data dir, so we restore next to
+	// the member directory and only replace it once the restore succeeds.
+	// The snapshot file is passed as a positional parameter so it is never parsed by the shell
+	restoreCmd := fmt.Sprintf("rm -rf /etcd-data/restore && "+
+		"/usr/local/bin/etcdctl snapshot restore \"$1\" "+
+		"--data-dir=/etcd-data/restore "+
+		"--name=etcd-%s "+
+		"--initial-cluster=%s "+
+		"--initial-cluster-token=etcd-cluster-1 "+
+		"--initial-advertise-peer-urls=https://%s:2380 && "+
+		"rm -rf /etcd-data/member && mv /etcd-data/restore/member /etcd-data/member && rm -rf /etcd-data/restore",
+		host.HostnameOverride, initCluster, host.InternalAddress)
+	imageCfg := &container.Config{
+		Image: etcdService.Image,
+		Tty:   true,
+		Env:   []string{"ETCDCTL_API=3"},
+		Cmd:   []string{"/bin/sh", "-c", restoreCmd, EtcdRestoreContainerName, EtcdSnapshotMountPath + "/" + snapshotName},
+	}
+	hostCfg := &container.HostConfig{
+		Binds: []string{
+			EtcdSnapshotPath + ":" + EtcdSnapshotMountPath + ":z",
+			"/var/lib/etcd:/etcd-data:z",
+		},
+		NetworkMode: "host",
+	}
+	return imageCfg, hostCfg
+}
+
+func runEtcdOneShotContainer(ctx context.Context, host *hosts.Host, imageCfg *container.Config, hostCfg *container.HostConfig, containerName string, prsMap map[string]v3.PrivateRegistry) error {
+	// remove leftovers of a previous failed run, otherwise the old command would be started again
+	if err := docker.DoRemoveContainer(ctx, host.DClient, containerName, host.Address); err != nil {
+		return err
+	}
+	if err := docker.DoRunContainer(ctx, host.DClient, imageCfg, hostCfg, containerName, host.Address, ETCDRole, prsMap); err != nil {
+		return err
+	}
+	if err := docker.WaitForContainer(ctx, host.DClient, containerName); err != nil {
+		return err
+	}
+	containerInspect, err := docker.InspectContainer(ctx, host.DClient, host.Address, containerName)
+	if err != nil {
+		return err
+	}
+	if containerInspect.State.ExitCode != 0 {
+		containerLog := ""
+		if logReader, err := docker.ReadContainerLogs(ctx, host.DClient, containerName); err == nil {
+			logBytes, _ := ioutil.ReadAll(logReader)
+			logReader.Close()
+			containerLog = string(logBytes)
+		}
+		return fmt.Errorf("Container [%s] on host [%s] exited with code [%d]: %s", containerName, host.Address, containerInspect.State.ExitCode, containerLog)
+	}
+	return docker.RemoveContainer(ctx, host.DClient, host.Address, containerName)
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/rancher/rke/hosts"
@@ -15,6 +16,16 @@ const (
 	TestEtcdNamePrefix        = "--name=etcd-"
 	TestEtcdVolumeBind        = "/var/lib/etcd:/etcd-data:z"
 	TestEtcdExtraArgs         = "--foo=bar"
+
+	TestEtcdSnapshotName         = "snapshot1"
+	TestEtcdSnapshotFile         = "/backup/snapshot1"
+	TestEtcdSnapshotVolumeBind   = "/opt/rke/etcd-snapshots:/backup:z"
+	TestRestoreEtcdClusterString = "etcd-etcd1=https://1.1.1.1:2380"
+	TestEtcdRestoreDataDir       = "--data-dir=/etcd-data/restore"
+	TestEtcdRemoveMemberData     = "rm -rf /etcd-data/member"
+
+	TestEtcdRollingSnapshotInterval  = "sleep 1800"
+	TestEtcdRollingSnapshotRetention = "-mmin +120"
 )
 
 func TestEtcdConfig(t *testing.T) {
@@ -55,7 +66,105 @@ func TestEtcdConfig(t *testing.T) {
 			fmt.Sprintf("Failed to verify [%s] as Etcd Image", TestEtcdImage))
 		assertEqual(t, isStringInSlice(TestEtcdVolumeBind, hostCfg.Binds), true,
 			fmt.Sprintf("Failed to find [%s] in volume binds of Etcd Service", TestEtcdVolumeBind))
-		assertEqual(t, isStringInSlice(TestEtcdExtraArgs, imageCfg.Entrypoint), true,
+		assertEqual(t, isStringInSlice(TestEtcdExtraArgs, imageCfg.Cmd), true,
 			fmt.Sprintf("Failed to find [%s] in extra args of Etcd Service", TestEtcdExtraArgs))
 	}
 }
+
+func TestEtcdSnapshotConfig(t *testing.T) {
+	etcdHost := &hosts.Host{
+		RKEConfigNode: v3.RKEConfigNode{
+			Address:          "1.1.1.1",
+			InternalAddress:  "1.1.1.1",
+			Role:             []string{"etcd"},
+			HostnameOverride: "etcd1",
+		},
+		DClient: nil,
+	}
+	etcdService := v3.ETCDService{}
+	etcdService.Image = TestEtcdImage
+
+	imageCfg, hostCfg := buildEtcdSnapshotConfig(etcdHost, etcdService, TestEtcdSnapshotName)
+	assertEqual(t, TestEtcdImage, imageCfg.Image,
+		fmt.Sprintf("Failed to verify [%s] as Etcd snapshot Image", TestEtcdImage))
+	assertEqual(t, isStringInSlice(TestEtcdSnapshotFile, imageCfg.Cmd), true,
+		fmt.Sprintf("Failed to find [%s] in Etcd snapshot command", TestEtcdSnapshotFile))
+	assertEqual(t, isStringInSlice(TestEtcdSnapshotVolumeBind, hostCfg.Binds), true,
+		fmt.Sprintf("Failed to find [%s] in volume binds of Etcd snapshot container", TestEtcdSnapshotVolumeBind))
+
+	imageCfg, hostCfg = buildEtcdRestoreConfig(etcdHost, etcdService, TestEtcdSnapshotName, getEtcdInitialCluster([]*hosts.Host{etcdHost}))
+	assertEqual(t, strings.Contains(imageCfg.Cmd[2], "--initial-cluster="+TestRestoreEtcdClusterString), true,
+		fmt.Sprintf("Failed to find single member initial cluster [%s] in Etcd restore command", TestRestoreEtcdClusterString))
+	assertEqual(t, isStringInSlice(TestEtcdVolumeBind, hostCfg.Binds), true,
+		fmt.Sprintf("Failed to find [%s] in volume binds of Etcd restore container", TestEtcdVolumeBind))
+	assertEqual(t, imageCfg.Cmd[len(imageCfg.Cmd)-1], TestEtcdSnapshotFile,
+		fmt.Sprintf("Failed to find [%s] as argument of Etcd restore command", TestEtcdSnapshotFile))
+	assertEqual(t, strings.Contains(imageCfg.Cmd[2], TestEtcdSnapshotName), false,
+		"Snapshot name must not be part of the Etcd restore shell command")
+	assertEqual(t, strings.Index(imageCfg.Cmd[2], TestEtcdRestoreDataDir) < strings.Index(imageCfg.Cmd[2], TestEtcdRemoveMemberData), true,
+		"Etcd member data must only be removed after the snapshot is restored")
+
+	for _, snapshotName := range []string{"", "../snapshot", "snapshot; rm -rf /", "$(id)", "-snapshot"} {
+		assertEqual(t, ValidateEtcdSnapshotName(snapshotName) != nil, true,
+			fmt.Sprintf("Failed to reject invalid snapshot name [%s]", snapshotName))
+	}
+	assertEqual(t, ValidateEtcdSnapshotName("snapshot-2018-01-01T00-00-00Z.db"), nil, "Failed to accept valid snapshot name")
+}
+
+func TestEtcdRollingSnapshotConfig(t *testing.T) {
+	etcdHost := &hosts.Host{
+		RKEConfigNode: v3.RKEConfigNode{
+			Address:          "1.1.1.1",
+			InternalAddress:  "1.1.1.1",
+			Role:             []string{"etcd"},
+			HostnameOverride: "etcd1",
+		},
+		DClient: nil,
+	}
+	etcdService := v3.ETCDService{}
+	etcdService.Image = TestEtcdImage
+	etcdService.Snapshot = &v3.ETCDSnapshot{
+		Interval:  "30m",
+		Retention: "2h",
+	}
+
+	imageCfg, hostCfg, err := buildEtcdRollingSnapshotConfig(etcdHost, etcdService)
+	if err != nil {
+		t.Fatalf("Failed to build Etcd rolling snapshot config: %v", err)
+	}
+	assertEqual(t, TestEtcdImage, imageCfg.Image,
+		fmt.Sprintf("Failed to verify [%s] as Etcd rolling snapshot Image", TestEtcdImage))
+	assertEqual(t, strings.Contains(imageCfg.Cmd[2], TestEtcdRollingSnapshotInterval), true,
+		fmt.Sprintf("Failed to find [%s] in Etcd rolling snapshot command", TestEtcdRollingSnapshotInterval))
+	assertEqual(t, strings.Contains(imageCfg.Cmd[2], TestEtcdRollingSnapshotRetention), true,
+		fmt.Sprintf("Failed to find [%s] in Etcd rolling snapshot command", TestEtcdRollingSnapshotRetention))
+	assertEqual(t, isStringInSlice(TestEtcdSnapshotVolumeBind, hostCfg.Binds), true,
+		fmt.Sprintf("Failed to find [%s] in volume binds of Etcd rolling snapshot container", TestEtcdSnapshotVolumeBind))
+
+	etcdService.Snapshot.Interval = "foo"
+	if _, _, err := buildEtcdRollingSnapshotConfig(etcdHost, etcdService); err == nil {
+		t.Fatalf("Failed to catch error when parsing incorrect Etcd snapshot interval")
+	}
+}
+
+func TestEtcdMembershipChange(t *testing.T) {
+	tests := []struct {
+		members, healthy, toRemove, toRemoveHealthy int
+		valid                                       bool
+	}{
+		{3, 3, 0, 0, true},
+		{3, 3, 1, 1, true},
+		{3, 3, 2, 2, false},
+		{3, 2, 1, 0, true},
+		{3, 2, 1, 1, false},
+		{3, 1, 0, 0, false},
+		{5, 5, 2, 2, true},
+		{5, 5, 3, 3, false},
+		{1, 1, 1, 1, false},
+	}
+	for _, test := range tests {
+		err := ValidateEtcdMembershipChange(test.members, test.healthy, test.toRemove, test.toRemoveHealthy)
+		assertEqual(t, err == nil, test.valid,
+			fmt.Sprintf("Failed to validate removing [%d] members, [%d] healthy, from [%d] members, [%d] healthy: %v", test.toRemove, test.toRemoveHealthy, test.members, test.healthy, err))
+	}
+}
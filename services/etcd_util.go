@@ -42,37 +42,44 @@ func getEtcdClient(ctx context.Context, etcdHost *hosts.Host, localConnDialerFac
 func isEtcdHealthy(ctx context.Context, localConnDialerFactory hosts.DialerFactory, host *hosts.Host, cert, key []byte) bool {
 	logrus.Debugf("[etcd] Check etcd cluster health")
 	for i := 0; i < 3; i++ {
-		dialer, err := getEtcdDialer(localConnDialerFactory, host)
-		if err != nil {
-			return false
-		}
-		tlsConfig, err := getEtcdTLSConfig(cert, key)
-		if err != nil {
-			logrus.Debugf("[etcd] Failed to create etcd tls config for host [%s]: %v", host.Address, err)
-			return false
-		}
-
-		hc := http.Client{
-			Transport: &http.Transport{
-				Dial:                dialer,
-				TLSClientConfig:     tlsConfig,
-				TLSHandshakeTimeout: 10 * time.Second,
-			},
-		}
-		healthy, err := getHealthEtcd(hc, host)
-		if err != nil {
+		if err := getEtcdHealth(localConnDialerFactory, host, cert, key); err != nil {
 			logrus.Debug(err)
 			time.Sleep(5 * time.Second)
 			continue
 		}
-		if healthy == "true" {
-			logrus.Debugf("[etcd] etcd cluster is healthy")
-			return true
-		}
+		logrus.Debugf("[etcd] etcd cluster is healthy")
+		return true
 	}
 	return false
 }
 
+func getEtcdHealth(localConnDialerFactory hosts.DialerFactory, host *hosts.Host, cert, key []byte) error {
+	dialer, err := getEtcdDialer(localConnDialerFactory, host)
+	if err != nil {
+		return fmt.Errorf("Failed to create a dialer for host [%s]: %v", host.Address, err)
+	}
+	tlsConfig, err := getEtcdTLSConfig(cert, key)
+	if err != nil {
+		return fmt.Errorf("Failed to create etcd tls config for host [%s]: %v", host.Address, err)
+	}
+	hc := http.Client{
+		Transport: &http.Transport{
+			Dial:                dialer,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		Timeout: 10 * time.Second,
+	}
+	healthy, err := getHealthEtcd(hc, host)
+	if err != nil {
+		return err
+	}
+	if healthy != "true" {
+		return fmt.Errorf("etcd on host [%s] is not healthy", host.Address)
+	}
+	return nil
+}
+
 func getHealthEtcd(hc http.Client, host *hosts.Host) (string, error) {
 	healthy := struct{ Health string }{}
 	resp, err := hc.Get("https://127.0.0.1:2379/health")
@@ -139,3 +146,40 @@ func getEtcdTLSConfig(certificate, key []byte) (*tls.Config, error) {
 	}
 	return tlsConfig, nil
 }
+
+// ValidateEtcdMembershipChange refuses removing a majority of the etcd members in one run, and removals that
+// would leave the etcd cluster without a quorum of healthy members
+func ValidateEtcdMembershipChange(members, healthyMembers, toRemove, toRemoveHealthy int) error {
+	if healthyMembers < getEtcdQuorum(members) {
+		return fmt.Errorf("Etcd cluster has no quorum, only [%d] of [%d] members are healthy", healthyMembers, members)
+	}
+	if toRemove == 0 {
+		return nil
+	}
+	if toRemove >= members {
+		return fmt.Errorf("Removing all the [%d] etcd members isn't allowed", members)
+	}
+	if toRemove > members/2 {
+		return fmt.Errorf("Removing [%d] of [%d] etcd members in one run would remove a majority of the etcd cluster", toRemove, members)
+	}
+	targetMembers := members - toRemove
+	targetHealthy := healthyMembers - toRemoveHealthy
+	if targetHealthy < getEtcdQuorum(targetMembers) {
+		return fmt.Errorf("Removing [%d] etcd members would leave [%d] healthy members out of [%d], below the quorum of [%d]", toRemove, targetHealthy, targetMembers, getEtcdQuorum(targetMembers))
+	}
+	return nil
+}
+
+// CheckEtcdClusterHealth returns nil if the etcd cluster is healthy through any of the hosts
+func CheckEtcdClusterHealth(ctx context.Context, etcdHosts []*hosts.Host, localConnDialerFactory hosts.DialerFactory, cert, key []byte) error {
+	for _, host := range etcdHosts {
+		if isEtcdHealthy(ctx, localConnDialerFactory, host, cert, key) {
+			return nil
+		}
+	}
+	return fmt.Errorf("Etcd cluster is not healthy")
+}
+
+func getEtcdQuorum(members int) int {
+	return members/2 + 1
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"github.com/docker/docker/api/types/container"
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/pki"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+)
+
+// ServiceContainerNames lists the service containers managed by RKE that are upgraded or removed by rke up
+var ServiceContainerNames = []string{
+	EtcdContainerName,
+	EtcdRollingSnapshotContainerName,
+	KubeAPIContainerName,
+	KubeControllerContainerName,
+	SchedulerContainerName,
+	NginxProxyContainerName,
+	KubeletContainerName,
+	KubeproxyContainerName,
+}
+
+type ContainerConfig struct {
+	Name  string
+	Plane string
+	Image *container.Config
+}
+
+// GetHostContainersConfig returns the configuration of the service containers RKE runs on the host based on its roles
+func GetHostContainersConfig(host *hosts.Host, controlHosts, etcdHosts []*hosts.Host, rkeServices v3.RKEConfigServices, nginxProxyImage, authorizationMode string) ([]ContainerConfig, error) {
+	containers := []ContainerConfig{}
+	if host.IsEtcd {
+		nodeName := pki.GetEtcdCrtName(host.InternalAddress)
+		imageCfg, _ := buildEtcdConfig(host, rkeServices.Etcd, getEtcdInitialCluster(etcdHosts), nodeName)
+		containers = append(containers, ContainerConfig{EtcdContainerName, ETCDRole, imageCfg})
+		if rkeServices.Etcd.Snapshot != nil {
+			imageCfg, _, err := buildEtcdRollingSnapshotConfig(host, rkeServices.Etcd)
+			if err != nil {
+				return nil, err
+			}
+			containers = append(containers, ContainerConfig{EtcdRollingSnapshotContainerName, ETCDRole, imageCfg})
+		}
+	}
+	if host.IsControl {
+		imageCfg, _ := buildKubeAPIConfig(host, rkeServices.KubeAPI, GetEtcdConnString(etcdHosts), authorizationMode)
+		containers = append(containers, ContainerConfig{KubeAPIContainerName, ControlRole, imageCfg})
+		imageCfg, _ = buildKubeControllerConfig(rkeServices.KubeController, authorizationMode)
+		containers = append(containers, ContainerConfig{KubeControllerContainerName, ControlRole, imageCfg})
+		imageCfg, _ = buildSchedulerConfig(host, rkeServices.Scheduler)
+		containers = append(containers, ContainerConfig{SchedulerContainerName, ControlRole, imageCfg})
+	} else {
+		imageCfg, _ := buildNginxProxyConfig(host, buildProxyEnv(controlHosts), nginxProxyImage)
+		containers = append(containers, ContainerConfig{NginxProxyContainerName, WorkerRole, imageCfg})
+	}
+	// worker components run on all hosts
+	imageCfg, _ := buildKubeletConfig(host, rkeServices.Kubelet)
+	containers = append(containers, ContainerConfig{KubeletContainerName, WorkerRole, imageCfg})
+	imageCfg, _ = buildKubeproxyConfig(host, rkeServices.Kubeproxy)
+	containers = append(containers, ContainerConfig{KubeproxyContainerName, WorkerRole, imageCfg})
+	return containers, nil
+}
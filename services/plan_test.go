@@ -0,0 +1,82 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rancher/rke/hosts"
+	"github.com/rancher/types/apis/management.cattle.io/v3"
+)
+
+const (
+	TestPlanKubeAPIImage = "test/k8s:v1"
+	TestPlanEtcdImage    = "test/etcd:v1"
+)
+
+func TestHostContainersConfig(t *testing.T) {
+	cpHost := &hosts.Host{
+		RKEConfigNode: v3.RKEConfigNode{
+			Address:          "1.1.1.1",
+			InternalAddress:  "1.1.1.1",
+			Role:             []string{"controlplane", "etcd"},
+			HostnameOverride: "cp1",
+		},
+		IsControl: true,
+		IsEtcd:    true,
+	}
+	workerHost := &hosts.Host{
+		RKEConfigNode: v3.RKEConfigNode{
+			Address:          "2.2.2.2",
+			InternalAddress:  "2.2.2.2",
+			Role:             []string{"worker"},
+			HostnameOverride: "worker1",
+		},
+		IsWorker: true,
+	}
+	rkeServices := v3.RKEConfigServices{
+		Etcd:    v3.ETCDService{Image: TestPlanEtcdImage},
+		KubeAPI: v3.KubeAPIService{Image: TestPlanKubeAPIImage},
+	}
+	cpHosts := []*hosts.Host{cpHost}
+
+	containers, err := GetHostContainersConfig(cpHost, cpHosts, cpHosts, rkeServices, TestNginxProxyImage, RBACAuthorizationMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, getContainerNames(containers), strings.Join([]string{
+		EtcdContainerName,
+		KubeAPIContainerName,
+		KubeControllerContainerName,
+		SchedulerContainerName,
+		KubeletContainerName,
+		KubeproxyContainerName,
+	}, ","), "")
+	assertEqual(t, containers[1].Image.Image, TestPlanKubeAPIImage,
+		fmt.Sprintf("Failed to verify [%s] as Kube API Image", TestPlanKubeAPIImage))
+
+	rkeServices.Etcd.Snapshot = &v3.ETCDSnapshot{Interval: "6h", Retention: "24h"}
+	containers, err = GetHostContainersConfig(cpHost, cpHosts, cpHosts, rkeServices, TestNginxProxyImage, RBACAuthorizationMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, containers[1].Name, EtcdRollingSnapshotContainerName, "")
+
+	containers, err = GetHostContainersConfig(workerHost, cpHosts, cpHosts, rkeServices, TestNginxProxyImage, RBACAuthorizationMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, getContainerNames(containers), strings.Join([]string{
+		NginxProxyContainerName,
+		KubeletContainerName,
+		KubeproxyContainerName,
+	}, ","), "")
+}
+
+func getContainerNames(containers []ContainerConfig) string {
+	names := []string{}
+	for _, container := range containers {
+		names = append(names, container.Name)
+	}
+	return strings.Join(names, ",")
+}
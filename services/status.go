@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	etcdclient "github.com/coreos/etcd/client"
+	"github.com/rancher/rke/docker"
+	"github.com/rancher/rke/hosts"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ContainerStateMissing     = "missing"
+	ContainerStateUnreachable = "unreachable"
+
+	HealthStatusHealthy   = "healthy"
+	HealthStatusUnhealthy = "unhealthy"
+)
+
+type ContainerStatus struct {
+	Host         string    `json:"host"`
+	Name         string    `json:"name"`
+	State        string    `json:"state"`
+	Image        string    `json:"image,omitempty"`
+	RestartCount int       `json:"restartCount"`
+	StartedAt    time.Time `json:"startedAt,omitempty"`
+	Uptime       string    `json:"uptime,omitempty"`
+	Health       string    `json:"health,omitempty"`
+	HealthError  string    `json:"healthError,omitempty"`
+}
+
+type EtcdMemberStatus struct {
+	Host    string `json:"host"`
+	Name    string `json:"name"`
+	Member  bool   `json:"member"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+type healthzEndpoint struct {
+	port   int
+	useTLS bool
+}
+
+var serviceHealthzEndpoints = map[string]healthzEndpoint{
+	KubeAPIContainerName:        {KubeAPIPort, true},
+	KubeControllerContainerName: {KubeControllerPort, false},
+	SchedulerContainerName:      {SchedulerPort, false},
+	KubeletContainerName:        {KubeletPort, true},
+	KubeproxyContainerName:      {KubeproxyPort, false},
+}
+
+// GetHostContainersStatus inspects the RKE containers expected on the host based on its roles,
+// and checks the /healthz endpoint of the running Kubernetes components once
+func GetHostContainersStatus(ctx context.Context, host *hosts.Host, localConnDialerFactory hosts.DialerFactory, now time.Time) ([]ContainerStatus, error) {
+	statuses := []ContainerStatus{}
+	for _, containerName := range getHostStatusContainerNames(host) {
+		status := ContainerStatus{
+			Host: host.Address,
+			Name: containerName,
+		}
+		exists, err := docker.IsContainerRunning(ctx, host.DClient, host.Address, containerName, true)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			status.State = ContainerStateMissing
+			statuses = append(statuses, status)
+			continue
+		}
+		containerInspect, err := docker.InspectContainer(ctx, host.DClient, host.Address, containerName)
+		if err != nil {
+			return nil, err
+		}
+		status.State = containerInspect.State.Status
+		status.Image = containerInspect.Config.Image
+		status.RestartCount = containerInspect.RestartCount
+		if containerInspect.State.Running {
+			if startedAt, err := time.Parse(time.RFC3339Nano, containerInspect.State.StartedAt); err == nil {
+				status.StartedAt = startedAt
+				// Duration.Round is not available with go1.8
+				status.Uptime = ((now.Sub(startedAt) / time.Second) * time.Second).String()
+			}
+		}
+		if endpoint, ok := serviceHealthzEndpoints[containerName]; ok {
+			if err := checkServiceHealthz(host, endpoint, containerName, localConnDialerFactory, containerInspect.State.Running); err != nil {
+				status.Health = HealthStatusUnhealthy
+				status.HealthError = err.Error()
+			} else {
+				status.Health = HealthStatusHealthy
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// GetUnreachableHostContainersStatus reports the RKE containers expected on a host that can't be reached
+func GetUnreachableHostContainersStatus(host *hosts.Host) []ContainerStatus {
+	statuses := []ContainerStatus{}
+	for _, containerName := range getHostStatusContainerNames(host) {
+		statuses = append(statuses, ContainerStatus{
+			Host:  host.Address,
+			Name:  containerName,
+			State: ContainerStateUnreachable,
+		})
+	}
+	return statuses
+}
+
+// GetEtcdMembersStatus reports the etcd membership and health of every etcd host
+func GetEtcdMembersStatus(ctx context.Context, etcdHosts []*hosts.Host, localConnDialerFactory hosts.DialerFactory, cert, key []byte) []EtcdMemberStatus {
+	var members []etcdclient.Member
+	var listErr error
+	for _, host := range etcdHosts {
+		etcdClient, err := getEtcdClient(ctx, host, localConnDialerFactory, cert, key)
+		if err != nil {
+			listErr = fmt.Errorf("Failed to create etcd client for host [%s]: %v", host.Address, err)
+			continue
+		}
+		members, err = etcdclient.NewMembersAPI(etcdClient).List(ctx)
+		if err != nil {
+			listErr = fmt.Errorf("Failed to list etcd members from host [%s]: %v", host.Address, err)
+			logrus.Debug(listErr)
+			continue
+		}
+		listErr = nil
+		break
+	}
+
+	statuses := []EtcdMemberStatus{}
+	for _, host := range etcdHosts {
+		status := EtcdMemberStatus{
+			Host: host.Address,
+			Name: fmt.Sprintf("etcd-%s", host.HostnameOverride),
+		}
+		for _, member := range members {
+			if member.Name == status.Name {
+				status.Member = true
+				break
+			}
+		}
+		if err := getEtcdHealth(localConnDialerFactory, host, cert, key); err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Healthy = true
+		}
+		if listErr != nil && len(status.Error) == 0 {
+			status.Error = listErr.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func getHostStatusContainerNames(host *hosts.Host) []string {
+	containerNames := []string{}
+	if host.IsEtcd {
+		containerNames = append(containerNames, EtcdContainerName)
+	}
+	if host.IsControl {
+		containerNames = append(containerNames, KubeAPIContainerName, KubeControllerContainerName, SchedulerContainerName)
+	} else {
+		containerNames = append(containerNames, NginxProxyContainerName)
+	}
+	return append(containerNames, KubeletContainerName, KubeproxyContainerName, SidekickContainerName)
+}
+
+func checkServiceHealthz(host *hosts.Host, endpoint healthzEndpoint, serviceName string, localConnDialerFactory hosts.DialerFactory, running bool) error {
+	if !running {
+		return fmt.Errorf("service [%s] is not running on host [%s]", serviceName, host.Address)
+	}
+	client, err := getHealthCheckHTTPClient(host, endpoint.port, localConnDialerFactory)
+	if err != nil {
+		return fmt.Errorf("Failed to initiate new HTTP client for service [%s] for host [%s]", serviceName, host.Address)
+	}
+	client.Timeout = 10 * time.Second
+	return getHealthz(client, endpoint.useTLS, serviceName, host.Address, endpoint.port)
+}
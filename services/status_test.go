@@ -0,0 +1,46 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rancher/rke/hosts"
+)
+
+func TestHostStatusContainerNames(t *testing.T) {
+	etcdControlHost := &hosts.Host{IsControl: true, IsEtcd: true}
+	assertEqual(t, strings.Join(getHostStatusContainerNames(etcdControlHost), ","), strings.Join([]string{
+		EtcdContainerName,
+		KubeAPIContainerName,
+		KubeControllerContainerName,
+		SchedulerContainerName,
+		KubeletContainerName,
+		KubeproxyContainerName,
+		SidekickContainerName,
+	}, ","), "")
+
+	workerHost := &hosts.Host{IsWorker: true}
+	assertEqual(t, strings.Join(getHostStatusContainerNames(workerHost), ","), strings.Join([]string{
+		NginxProxyContainerName,
+		KubeletContainerName,
+		KubeproxyContainerName,
+		SidekickContainerName,
+	}, ","), "")
+
+	for _, containerName := range getHostStatusContainerNames(etcdControlHost) {
+		_, hasHealthz := serviceHealthzEndpoints[containerName]
+		expected := containerName != EtcdContainerName && containerName != SidekickContainerName
+		assertEqual(t, hasHealthz, expected, "Failed to verify healthz endpoint of "+containerName)
+	}
+}
+
+func TestUnreachableHostContainersStatus(t *testing.T) {
+	workerHost := &hosts.Host{IsWorker: true}
+	workerHost.Address = "1.1.1.1"
+	statuses := GetUnreachableHostContainersStatus(workerHost)
+	assertEqual(t, len(statuses), len(getHostStatusContainerNames(workerHost)), "Failed to report every container of unreachable host")
+	for _, status := range statuses {
+		assertEqual(t, status.Host, workerHost.Address, "Failed to verify host of unreachable container "+status.Name)
+		assertEqual(t, status.State, ContainerStateUnreachable, "Failed to verify state of unreachable container "+status.Name)
+	}
+}
@@ -2,60 +2,50 @@ package services
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/rancher/rke/docker"
 	"github.com/rancher/rke/hosts"
+	"github.com/rancher/rke/k8s"
 	"github.com/rancher/rke/log"
 	"github.com/rancher/types/apis/management.cattle.io/v3"
 	"golang.org/x/sync/errgroup"
+	"k8s.io/client-go/kubernetes"
 )
 
 const (
-	unschedulableEtcdTaint = "node-role.kubernetes.io/etcd=true:NoExecute"
+	workerNodeReadyTimeout = 5 * time.Minute
 )
 
 func RunWorkerPlane(ctx context.Context, controlHosts, workerHosts, etcdHosts []*hosts.Host, workerServices v3.RKEConfigServices, nginxProxyImage, sidekickImage string, localConnDialerFactory hosts.DialerFactory, prsMap map[string]v3.PrivateRegistry) error {
 	log.Infof(ctx, "[%s] Building up Worker Plane..", WorkerRole)
 	var errgrp errgroup.Group
 
-	// Deploy worker components on etcd hosts
-	for _, host := range etcdHosts {
-		if !host.IsControl && !host.IsWorker {
-			// Add unschedulable taint
-			host.ToAddTaints = append(host.ToAddTaints, unschedulableEtcdTaint)
+	// Deploy worker components on etcd hosts, then on control hosts and worker hosts
+	for _, planeHosts := range [][]*hosts.Host{etcdHosts, controlHosts, workerHosts} {
+		for _, host := range planeHosts {
+			runHost := host
+			errgrp.Go(func() error {
+				return DeployWorkerPlaneHost(ctx, runHost, controlHosts, workerServices, nginxProxyImage, sidekickImage, localConnDialerFactory, prsMap)
+			})
+		}
+		if err := errgrp.Wait(); err != nil {
+			return err
 		}
-		etcdHost := host
-		errgrp.Go(func() error {
-			return doDeployWorkerPlane(ctx, etcdHost, workerServices, nginxProxyImage, sidekickImage, localConnDialerFactory, controlHosts, prsMap)
-		})
-	}
-	if err := errgrp.Wait(); err != nil {
-		return err
-	}
-
-	// Deploy worker components on control hosts
-	for _, host := range controlHosts {
-		controlHost := host
-		errgrp.Go(func() error {
-			return doDeployWorkerPlane(ctx, controlHost, workerServices, nginxProxyImage, sidekickImage, localConnDialerFactory, controlHosts, prsMap)
-		})
-	}
-	if err := errgrp.Wait(); err != nil {
-		return err
-	}
-	// Deploy worker components on worker hosts
-	for _, host := range workerHosts {
-		workerHost := host
-		errgrp.Go(func() error {
-			return doDeployWorkerPlane(ctx, workerHost, workerServices, nginxProxyImage, sidekickImage, localConnDialerFactory, controlHosts, prsMap)
-		})
-	}
-	if err := errgrp.Wait(); err != nil {
-		return err
 	}
 	log.Infof(ctx, "[%s] Successfully started Worker Plane..", WorkerRole)
 	return nil
 }
 
+// DeployWorkerPlaneHost deploys the worker components on a host
+func DeployWorkerPlaneHost(ctx context.Context, host *hosts.Host, controlHosts []*hosts.Host, workerServices v3.RKEConfigServices, nginxProxyImage, sidekickImage string, localConnDialerFactory hosts.DialerFactory, prsMap map[string]v3.PrivateRegistry) error {
+	return doDeployWorkerPlane(ctx, host, workerServices, nginxProxyImage, sidekickImage, localConnDialerFactory, controlHosts, prsMap)
+}
+
 func RemoveWorkerPlane(ctx context.Context, workerHosts []*hosts.Host, force bool) error {
 	log.Infof(ctx, "[%s] Tearing down Worker Plane..", WorkerRole)
 	for _, host := range workerHosts {
@@ -106,3 +96,177 @@ func doDeployWorkerPlane(ctx context.Context, host *hosts.Host,
 	}
 	return runKubeproxy(ctx, host, workerServices.Kubeproxy, localConnDialerFactory, prsMap)
 }
+
+// UpgradeWorkerPlane deploys the worker plane like RunWorkerPlane, except for the running worker only hosts that need
+// an update: they are upgraded in batches of at most max_unavailable_worker hosts, each host is cordoned and optionally
+// drained, its worker components are updated, and it's uncordoned once its node is Ready.
+// The upgrade stops when more hosts than the failure threshold failed to upgrade
+func UpgradeWorkerPlane(ctx context.Context, kubeClient *kubernetes.Clientset, controlHosts, workerHosts, etcdHosts []*hosts.Host, workerServices v3.RKEConfigServices, nginxProxyImage, sidekickImage string, localConnDialerFactory hosts.DialerFactory, prsMap map[string]v3.PrivateRegistry, upgradeStrategy v3.UpgradeStrategy, drainConfig v3.NodeDrainConfig) error {
+	// worker hosts with other roles are deployed with the etcd and control hosts
+	if err := RunWorkerPlane(ctx, controlHosts, nil, etcdHosts, workerServices, nginxProxyImage, sidekickImage, localConnDialerFactory, prsMap); err != nil {
+		return err
+	}
+	workerOnlyHosts := []*hosts.Host{}
+	for _, host := range workerHosts {
+		if !host.IsControl && !host.IsEtcd {
+			workerOnlyHosts = append(workerOnlyHosts, host)
+		}
+	}
+	maxUnavailable, err := GetMaxUnavailableWorkers(upgradeStrategy.MaxUnavailableWorker, len(workerOnlyHosts))
+	if err != nil {
+		return err
+	}
+
+	toUpgradeHosts := []*hosts.Host{}
+	var errgrp errgroup.Group
+	for _, host := range workerOnlyHosts {
+		upgrade, err := isWorkerHostUpgradable(ctx, host, controlHosts, workerServices, nginxProxyImage)
+		if err != nil {
+			return err
+		}
+		if upgrade {
+			toUpgradeHosts = append(toUpgradeHosts, host)
+			continue
+		}
+		// new hosts aren't part of the cluster yet, they don't need to be drained
+		workerHost := host
+		errgrp.Go(func() error {
+			return doDeployWorkerPlane(ctx, workerHost, workerServices, nginxProxyImage, sidekickImage, localConnDialerFactory, controlHosts, prsMap)
+		})
+	}
+	if err := errgrp.Wait(); err != nil {
+		return err
+	}
+
+	failedHosts := []string{}
+	for start := 0; start < len(toUpgradeHosts); start += maxUnavailable {
+		end := start + maxUnavailable
+		if end > len(toUpgradeHosts) {
+			end = len(toUpgradeHosts)
+		}
+		batch := toUpgradeHosts[start:end]
+		log.Infof(ctx, "[%s] Upgrading worker hosts [%s]", WorkerRole, getHostsAddresses(batch))
+		upgradeErrs := make([]error, len(batch))
+		var wg sync.WaitGroup
+		for i, host := range batch {
+			wg.Add(1)
+			go func(i int, host *hosts.Host) {
+				defer wg.Done()
+				upgradeErrs[i] = upgradeWorkerHost(ctx, kubeClient, host, workerServices, nginxProxyImage, sidekickImage, localConnDialerFactory, controlHosts, prsMap, upgradeStrategy.Drain, drainConfig)
+			}(i, host)
+		}
+		wg.Wait()
+		for i, err := range upgradeErrs {
+			if err != nil {
+				log.Warnf(ctx, "[%s] Failed to upgrade worker host [%s], the host is left cordoned: %v", WorkerRole, batch[i].Address, err)
+				failedHosts = append(failedHosts, batch[i].Address)
+			}
+		}
+		if len(failedHosts) > upgradeStrategy.FailureThreshold {
+			return fmt.Errorf("Worker Plane upgrade stopped, [%d] hosts failed to upgrade which exceeds the failure threshold [%d]: %s", len(failedHosts), upgradeStrategy.FailureThreshold, strings.Join(failedHosts, ","))
+		}
+	}
+	if len(failedHosts) > 0 {
+		log.Warnf(ctx, "[%s] Worker hosts [%s] failed to upgrade", WorkerRole, strings.Join(failedHosts, ","))
+	}
+	log.Infof(ctx, "[%s] Successfully started Worker Plane..", WorkerRole)
+	return nil
+}
+
+func upgradeWorkerHost(ctx context.Context, kubeClient *kubernetes.Clientset, host *hosts.Host,
+	workerServices v3.RKEConfigServices,
+	nginxProxyImage, sidekickImage string,
+	localConnDialerFactory hosts.DialerFactory,
+	controlHosts []*hosts.Host,
+	prsMap map[string]v3.PrivateRegistry,
+	drain bool, drainConfig v3.NodeDrainConfig) error {
+
+	node, err := k8s.GetNode(kubeClient, host.HostnameOverride)
+	if err != nil {
+		return err
+	}
+	// nodes cordoned before the upgrade are left cordoned
+	wasCordoned := node.Spec.Unschedulable
+	if err := k8s.CordonUncordon(kubeClient, host.HostnameOverride, true); err != nil {
+		return err
+	}
+	if drain {
+		log.Infof(ctx, "[%s] Draining host [%s]", WorkerRole, host.Address)
+		if err := k8s.DrainNode(kubeClient, host.HostnameOverride, drainConfig.GracePeriod, time.Duration(drainConfig.Timeout)*time.Second); err != nil {
+			return err
+		}
+	}
+	if err := doDeployWorkerPlane(ctx, host, workerServices, nginxProxyImage, sidekickImage, localConnDialerFactory, controlHosts, prsMap); err != nil {
+		return err
+	}
+	if err := k8s.WaitForNodeReady(kubeClient, host.HostnameOverride, workerNodeReadyTimeout); err != nil {
+		return err
+	}
+	if wasCordoned {
+		return nil
+	}
+	return k8s.CordonUncordon(kubeClient, host.HostnameOverride, false)
+}
+
+// isWorkerHostUpgradable returns true if the kubelet is running on the host and any worker container needs to be updated
+func isWorkerHostUpgradable(ctx context.Context, host *hosts.Host, controlHosts []*hosts.Host, workerServices v3.RKEConfigServices, nginxProxyImage string) (bool, error) {
+	running, err := docker.IsContainerRunning(ctx, host.DClient, host.Address, KubeletContainerName, false)
+	if err != nil || !running {
+		return false, err
+	}
+	containers, err := GetHostContainersConfig(host, controlHosts, nil, workerServices, nginxProxyImage, "")
+	if err != nil {
+		return false, err
+	}
+	for _, containerConfig := range containers {
+		exists, err := docker.IsContainerRunning(ctx, host.DClient, host.Address, containerConfig.Name, true)
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			return true, nil
+		}
+		upgradable, err := docker.IsContainerUpgradable(ctx, host.DClient, containerConfig.Image, containerConfig.Name, host.Address, containerConfig.Plane)
+		if err != nil {
+			return false, err
+		}
+		if upgradable {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetMaxUnavailableWorkers parses max_unavailable_worker, a number or a percentage of the worker hosts, at least one host
+// is upgraded at a time
+func GetMaxUnavailableWorkers(maxUnavailable string, workerHostsCount int) (int, error) {
+	if len(maxUnavailable) == 0 {
+		return 1, nil
+	}
+	var count int
+	if strings.HasSuffix(maxUnavailable, "%") {
+		percentage, err := strconv.Atoi(strings.TrimSuffix(maxUnavailable, "%"))
+		if err != nil || percentage <= 0 || percentage > 100 {
+			return 0, fmt.Errorf("Invalid max_unavailable_worker [%s], percentage should be between 1%% and 100%%", maxUnavailable)
+		}
+		count = workerHostsCount * percentage / 100
+	} else {
+		var err error
+		count, err = strconv.Atoi(maxUnavailable)
+		if err != nil || count <= 0 {
+			return 0, fmt.Errorf("Invalid max_unavailable_worker [%s], should be a positive number or a percentage", maxUnavailable)
+		}
+	}
+	if count < 1 {
+		count = 1
+	}
+	return count, nil
+}
+
+func getHostsAddresses(hostList []*hosts.Host) string {
+	addresses := []string{}
+	for _, host := range hostList {
+		addresses = append(addresses, host.Address)
+	}
+	return strings.Join(addresses, ",")
+}
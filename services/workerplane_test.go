@@ -0,0 +1,34 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMaxUnavailableWorkers(t *testing.T) {
+	maxUnavailableTests := []struct {
+		maxUnavailable string
+		workers        int
+		expected       int
+	}{
+		{"", 10, 1},
+		{"3", 10, 3},
+		{"20%", 10, 2},
+		{"25%", 10, 2},
+		{"10%", 3, 1},
+		{"100%", 4, 4},
+	}
+	for _, test := range maxUnavailableTests {
+		count, err := GetMaxUnavailableWorkers(test.maxUnavailable, test.workers)
+		if err != nil {
+			t.Fatalf("Failed to parse max unavailable workers [%s]: %v", test.maxUnavailable, err)
+		}
+		assertEqual(t, count, test.expected,
+			fmt.Sprintf("Failed to verify max unavailable workers [%s] of [%d] workers: %d != %d", test.maxUnavailable, test.workers, count, test.expected))
+	}
+	for _, invalid := range []string{"0", "-1", "abc", "0%", "150%", "%"} {
+		if _, err := GetMaxUnavailableWorkers(invalid, 10); err == nil {
+			t.Fatalf("Max unavailable workers [%s] should be invalid", invalid)
+		}
+	}
+}